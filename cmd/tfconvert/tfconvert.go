@@ -7,7 +7,7 @@ import (
 	"fmt"
 	"io/ioutil"
 	"os"
-	"os/exec"
+	"path/filepath"
 	"strings"
 
 	"github.com/cr-norton/tfconvert/pkg/aws"
@@ -18,100 +18,368 @@ import (
 )
 
 var (
-	directory string
-	save      bool
+	directory     string
+	snapshot      string
+	fromSnapshots stringsFlag
+	importMode    string
+	state         bool
+	verifyState   string
 )
 
+// stringsFlag is a flag that may be repeated
+type stringsFlag []string
+
+func (s *stringsFlag) String() string {
+	return strings.Join(*s, ",")
+}
+
+func (s *stringsFlag) Set(value string) error {
+	*s = append(*s, value)
+	return nil
+}
+
 func main() {
 	options, err := parseFlags()
 	if err != nil {
 		log.Fatal(err)
 	}
-	if options.StackName == "" {
-		log.Fatal("stack name is required")
-	}
 
-	client, err := aws.New(options.Region)
+	stacks, err := loadStacks(context.Background(), *options)
 	if err != nil {
-		log.Fatalf("unable to configure aws client: %v", err)
+		log.Fatal(err)
+	}
+	for _, stack := range stacks {
+		stack.GroupFunctions = options.GroupFunctions
 	}
 
-	ctx := context.Background()
-	stack, err := client.GetStack(ctx, *options)
+	if snapshot != "" {
+		for _, stack := range stacks {
+			filename := snapshot
+			if len(stacks) > 1 {
+				ext := filepath.Ext(snapshot)
+				filename = fmt.Sprintf("%s.%s%s", strings.TrimSuffix(snapshot, ext), stack.Name, ext)
+			}
+			if err := saveSnapshot(filename, *stack); err != nil {
+				log.Fatal(err)
+			}
+		}
+	}
+
+	if len(stacks) == 1 {
+		err = convert(directory, stacks[0], *options)
+	} else {
+		err = convertBatch(directory, stacks, *options)
+	}
 	if err != nil {
-		log.Fatalf("unable to load cloudformation stack: %v", err)
+		log.Fatal(err)
+	}
+
+	log.Info("terraform migration complete")
+}
+
+func loadStacks(ctx context.Context, options types.Options) ([]*aws.Stack, error) {
+	stacks := []*aws.Stack{}
+	if options.TemplateFile != "" {
+		stack, err := loadTemplate(options)
+		if err != nil {
+			return nil, err
+		}
+		return []*aws.Stack{stack}, nil
+	}
+
+	if len(fromSnapshots) > 0 {
+		for _, filename := range fromSnapshots {
+			stack, err := loadSnapshot(filename)
+			if err != nil {
+				return nil, err
+			}
+			stack.ExportReferences = aws.NewExportReferences(options)
+			stacks = append(stacks, stack)
+		}
+		return stacks, nil
 	}
 
-	save = true
-	if save {
-		bytes, _ := json.Marshal(stack)
-		ioutil.WriteFile("stack.json", bytes, os.ModePerm)
+	if len(options.Stacks()) == 0 {
+		return nil, errors.New("stack name is required")
 	}
 
-	tfout, err := codegen.Generate(stack, *options, aws.TemplateFunctions)
+	client, err := aws.New(options)
 	if err != nil {
-		log.Fatalf("unable to generate tf templates: %v", err)
+		return nil, errors.Wrap(err, "unable to configure aws client")
 	}
 
-	err = writeFiles(directory, tfout)
+	names, err := client.StackNames(ctx, options.Stacks())
 	if err != nil {
-		log.Fatal(err)
+		return nil, err
+	}
+	for _, name := range names {
+		stackOptions := options
+		stackOptions.StackName, stackOptions.StackNames = name, nil
+		stack, err := client.GetStack(ctx, stackOptions)
+		if err != nil {
+			return nil, errors.Wrapf(err, "unable to load cloudformation stack %s", name)
+		}
+		stacks = append(stacks, stack.Stacks()...)
 	}
+	return stacks, nil
+}
 
-	err = writeScripts(directory, *stack)
+// convert writes the terraform of a single stack as the root module.
+func convert(directory string, stack *aws.Stack, options types.Options) error {
+	tfout, err := generate(stack, options)
 	if err != nil {
-		log.Fatal(err)
+		return err
+	}
+
+	if err := writeModule(directory, *stack, tfout); err != nil {
+		return err
+	}
+
+	if options.TemplateFile != "" {
+		// nothing is deployed to import
+		return nil
+	}
+	return writeImports(directory, stack.Resources(), map[string][]codegen.StateResource{"": stack.StateResources()})
+}
+
+// convertBatch writes the terraform of every stack as a module in a
+// subdirectory named after the stack, called from a root module.
+func convertBatch(directory string, stacks []*aws.Stack, options types.Options) error {
+	batch := aws.NewBatch(stacks)
+
+	modules := map[string]map[string]string{}
+	for _, stack := range stacks {
+		tfout, err := generate(stack, options)
+		if err != nil {
+			return err
+		}
+		// parameter values are set in the root module
+		delete(tfout, "terraform.tfvars")
+		modules[stack.Name] = tfout
 	}
 
-	err = terraFormat(directory)
+	for _, stack := range stacks {
+		files, err := batch.ModuleFiles(*stack)
+		if err != nil {
+			return err
+		}
+		for name, content := range files {
+			if content == "" {
+				continue
+			}
+			if existing := modules[stack.Name][name]; existing != "" {
+				content = existing + "\n" + content
+			}
+			modules[stack.Name][name] = content
+		}
+		if err := writeModule(fmt.Sprintf("%s/%s", directory, stack.Name), *stack, modules[stack.Name]); err != nil {
+			return err
+		}
+	}
+
+	root, err := batch.RootFiles()
 	if err != nil {
-		log.Fatal(err)
+		return err
+	}
+	if err := writeFiles(directory, root); err != nil {
+		return err
 	}
 
-	log.Info("terraform migration complete")
+	return writeImports(directory, batch.Resources(), batch.StateResources())
+}
+
+func generate(stack *aws.Stack, options types.Options) (map[string]string, error) {
+	tfout, err := codegen.Generate(stack, options, aws.TemplateFunctions)
+	if err != nil {
+		return nil, errors.Wrapf(err, "unable to generate tf templates for %s", stack.Name)
+	}
+
+	if err := codegen.CheckAddresses(tfout, stack.Resources()); err != nil {
+		return nil, err
+	}
+	return tfout, nil
+}
+
+func writeModule(directory string, stack aws.Stack, tfout map[string]string) error {
+	if err := writeFiles(directory, tfout); err != nil {
+		return err
+	}
+
+	if len(stack.Failures) > 0 {
+		if err := writeFailures(directory, stack.Failures); err != nil {
+			return err
+		}
+		log.Warnf("%d resources could not be fetched, see %s/failed_resources.json", len(stack.Failures), directory)
+	}
+	return nil
+}
+
+// writeImports writes the import script or blocks of the resources, and the
+// state of the modules when requested.
+func writeImports(directory string, resources []types.Resource, modules map[string][]codegen.StateResource) error {
+	if state {
+		if err := writeState(directory, modules); err != nil {
+			return err
+		}
+		resources = codegen.Unstated(resources, modules)
+		for _, r := range resources {
+			log.WithFields(log.Fields{
+				"module":     r.Module,
+				"address":    fmt.Sprintf("%s.%s", r.Type, codegen.Name(r.Identifier)),
+				"import_key": r.ImportKey,
+			}).Warn("unable to write resource to state, importing it instead")
+		}
+	}
+
+	if !state || len(resources) > 0 {
+		if err := writeScripts(directory, resources); err != nil {
+			return err
+		}
+	}
+
+	if verifyState != "" {
+		if err := compareState(verifyState, modules); err != nil {
+			return err
+		}
+	}
+	return nil
 }
 
 func parseFlags() (*types.Options, error) {
-	var config, stack, region, service string
+	var config, region, service, templateDir string
+	var stacks stringsFlag
+	var concurrency, maxRetries int
+	var rateLimit float64
+	var continueOnError bool
+	var nestedStacks, exportReferences, templateFile string
+	var groupFunctions bool
 
 	flag.StringVar(&config, "config", "", "config file location")
-	flag.StringVar(&stack, "stack", "", "stack name")
+	flag.Var(&stacks, "stack", "stack name or glob pattern, repeat to convert several stacks")
 	flag.StringVar(&region, "region", "", "aws region")
 	flag.StringVar(&service, "service", "", "service name")
 	flag.StringVar(&directory, "output", "./terraform", "output directory")
+	flag.StringVar(&templateDir, "templates", "", "directory of templates overriding the built in ones")
+	flag.IntVar(&concurrency, "concurrency", 8, "number of resources fetched at once")
+	flag.IntVar(&maxRetries, "max-retries", types.DefaultMaxRetries, "retries of a throttled or failed aws call, 0 to disable")
+	flag.Float64Var(&rateLimit, "rate-limit", types.DefaultRateLimit, "maximum requests per second to each aws service")
+	flag.BoolVar(&continueOnError, "continue-on-error", false, "report resources that can't be fetched instead of aborting")
+	flag.StringVar(&nestedStacks, "nested-stacks", types.NestedStacksFlatten, "convert nested stacks into their parent or as modules of their own (flatten, modules)")
+	flag.StringVar(&exportReferences, "export-references", types.ExportReferencesData, "reference values imported from other stacks with data sources, remote state or literals (data, remote_state, none)")
+	flag.BoolVar(&groupFunctions, "group-functions", false, "write every function to a file of its own with the role, event sources and log group generated for it by SAM")
+	flag.StringVar(&snapshot, "snapshot", "", "write the fetched stack to a snapshot file")
+	flag.StringVar(&templateFile, "template-file", "", "convert a CloudFormation template file instead of a deployed stack, without imports")
+	flag.Var(&fromSnapshots, "from-snapshot", "generate from a snapshot file instead of aws, repeat to convert several stacks")
+	flag.StringVar(&importMode, "import-mode", "script", "import with a terraform import script or terraform 1.5+ import blocks (script, blocks)")
+	flag.BoolVar(&state, "state", false, "write a terraform.tfstate instead of importing resources, importing only those it can't hold")
+	flag.StringVar(&verifyState, "verify-state", "", "compare the generated state with a state file from terraform import")
 	flag.Parse()
 
+	options := &types.Options{
+		StackNames:       stacks,
+		ServiceName:      service,
+		Region:           region,
+		AdditionalTags:   map[string]string{},
+		TemplateDir:      templateDir,
+		Concurrency:      concurrency,
+		MaxRetries:       maxRetries,
+		RateLimit:        rateLimit,
+		ContinueOnError:  continueOnError,
+		NestedStacks:     nestedStacks,
+		ExportReferences: exportReferences,
+		TemplateFile:     templateFile,
+		GroupFunctions:   groupFunctions,
+	}
 	if config != "" {
-		return loadConfig(config)
+		if err := loadConfig(config, options); err != nil {
+			return nil, err
+		}
 	}
 
-	if stack == "" {
-		return nil, errors.New("stack is required")
+	if importMode != "script" && importMode != "blocks" {
+		return nil, errors.Errorf("unknown import mode %q", importMode)
 	}
 
-	options := &types.Options{
-		StackName:      stack,
-		ServiceName:    service,
-		Region:         region,
-		AdditionalTags: map[string]string{},
+	if options.NestedStacks != types.NestedStacksFlatten && options.NestedStacks != types.NestedStacksModules {
+		return nil, errors.Errorf("unknown nested stacks mode %q", options.NestedStacks)
+	}
+
+	switch options.ExportReferences {
+	case types.ExportReferencesData, types.ExportReferencesRemoteState, types.ExportReferencesNone:
+	default:
+		return nil, errors.Errorf("unknown export references %q", options.ExportReferences)
 	}
-	if options.ServiceName == "" {
-		options.ServiceName = options.StackName
+
+	if options.Concurrency <= 0 {
+		return nil, errors.Errorf("concurrency must be positive, got %d", options.Concurrency)
+	}
+
+	if options.TemplateFile != "" && (snapshot != "" || len(fromSnapshots) > 0 || state || verifyState != "") {
+		return nil, errors.New("template-file can't be combined with snapshots or state")
+	}
+
+	if len(options.Stacks()) == 0 && len(fromSnapshots) == 0 && options.TemplateFile == "" {
+		return nil, errors.New("stack is required")
 	}
 	return options, nil
 }
 
-func loadConfig(filename string) (*types.Options, error) {
+// loadConfig overlays the options set in a config file on the options of the
+// flags.
+func loadConfig(filename string, options *types.Options) error {
+	bytes, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return errors.Wrap(err, "unable to read config file")
+	}
+
+	if err := json.Unmarshal(bytes, options); err != nil {
+		return errors.Wrap(err, "unable to parse codegen config")
+	}
+	if options.AdditionalTags == nil {
+		options.AdditionalTags = map[string]string{}
+	}
+	return nil
+}
+
+// loadTemplate converts a template file, as the stack named by the options or
+// after the file.
+func loadTemplate(options types.Options) (*aws.Stack, error) {
+	bytes, err := ioutil.ReadFile(options.TemplateFile)
+	if err != nil {
+		return nil, errors.Wrap(err, "unable to read template file")
+	}
+
+	stacks := options.Stacks()
+	if len(stacks) > 1 {
+		return nil, errors.New("a template file is converted as a single stack")
+	}
+	options.StackName, options.StackNames = "", nil
+	if len(stacks) == 1 {
+		options.StackName = stacks[0]
+	} else {
+		base := filepath.Base(options.TemplateFile)
+		options.StackName = strings.TrimSuffix(base, filepath.Ext(base))
+	}
+	return aws.LoadTemplate(bytes, options)
+}
+
+func loadSnapshot(filename string) (*aws.Stack, error) {
 	bytes, err := ioutil.ReadFile(filename)
 	if err != nil {
-		return nil, errors.Wrap(err, "unable to read config file")
+		return nil, errors.Wrap(err, "unable to read snapshot")
 	}
+	return aws.UnmarshalSnapshot(bytes)
+}
 
-	var options types.Options
-	if err := json.Unmarshal(bytes, &options); err != nil {
-		return nil, errors.Wrap(err, "unable to parse codegen config")
+func saveSnapshot(filename string, stack aws.Stack) error {
+	bytes, err := aws.MarshalSnapshot(stack)
+	if err != nil {
+		return errors.Wrap(err, "unable to create snapshot")
 	}
-	return &options, nil
+	if err := ioutil.WriteFile(filename, bytes, 0644); err != nil {
+		return errors.Wrap(err, "unable to write snapshot")
+	}
+	return nil
 }
 
 func writeFiles(directory string, files map[string]string) error {
@@ -132,8 +400,12 @@ func writeFiles(directory string, files map[string]string) error {
 	return nil
 }
 
-func writeScripts(directory string, stack aws.Stack) error {
-	commands, err := codegen.GenerateImportScript(stack.Resources())
+func writeScripts(directory string, resources []types.Resource) error {
+	if importMode == "blocks" {
+		return writeImportBlocks(directory, resources)
+	}
+
+	commands, err := codegen.GenerateImportScript(resources)
 	if err != nil {
 		return err
 	}
@@ -146,12 +418,67 @@ func writeScripts(directory string, stack aws.Stack) error {
 	return nil
 }
 
-func terraFormat(directory string) error {
-	if err := os.Chdir(directory); err != nil {
-		return errors.Wrap(err, "unable to cd to output directory")
+func writeImportBlocks(directory string, resources []types.Resource) error {
+	content, err := codegen.GenerateImportBlocks(resources)
+	if err != nil {
+		return err
+	}
+
+	file := fmt.Sprintf("%s/%s", directory, "imports.tf")
+	if err := ioutil.WriteFile(file, []byte(content), os.ModePerm); err != nil {
+		return errors.Wrap(err, "unable to write import blocks")
+	}
+	return nil
+}
+
+func writeState(directory string, modules map[string][]codegen.StateResource) error {
+	content, err := codegen.GenerateModuleState(modules)
+	if err != nil {
+		return errors.Wrap(err, "unable to generate terraform state")
+	}
+
+	file := fmt.Sprintf("%s/%s", directory, "terraform.tfstate")
+	if err := ioutil.WriteFile(file, content, 0644); err != nil {
+		return errors.Wrap(err, "unable to write terraform state")
 	}
-	if err := exec.Command("terraform", "fmt").Run(); err != nil {
-		return errors.Wrap(err, "unable to format terraform code")
+	return nil
+}
+
+func compareState(filename string, modules map[string][]codegen.StateResource) error {
+	imported, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return errors.Wrap(err, "unable to read imported state")
+	}
+
+	generated, err := codegen.GenerateModuleState(modules)
+	if err != nil {
+		return errors.Wrap(err, "unable to generate terraform state")
+	}
+
+	diffs, err := codegen.CompareState(generated, imported)
+	if err != nil {
+		return err
+	}
+	for _, diff := range diffs {
+		log.Warn(diff)
+	}
+	if len(diffs) > 0 {
+		return errors.Errorf("generated state differs from %s in %d places", filename, len(diffs))
+	}
+
+	log.Info("generated state matches imported state")
+	return nil
+}
+
+func writeFailures(directory string, failures []aws.Failure) error {
+	bytes, err := json.MarshalIndent(failures, "", "  ")
+	if err != nil {
+		return errors.Wrap(err, "unable to create failure report")
+	}
+
+	file := fmt.Sprintf("%s/%s", directory, "failed_resources.json")
+	if err := ioutil.WriteFile(file, bytes, 0644); err != nil {
+		return errors.Wrap(err, "unable to write failure report")
 	}
 	return nil
 }
@@ -1,24 +1,31 @@
 module github.com/cr-norton/tfconvert
 
-go 1.14
+go 1.16
 
 require (
-	github.com/aws/aws-sdk-go-v2/config v1.1.6
-	github.com/aws/aws-sdk-go-v2/service/cloudformation v1.3.2
-	github.com/aws/aws-sdk-go-v2/service/cloudwatchlogs v1.2.2
-	github.com/aws/aws-sdk-go-v2/service/dynamodb v1.2.2
-	github.com/aws/aws-sdk-go-v2/service/firehose v1.2.2
-	github.com/aws/aws-sdk-go-v2/service/iam v1.3.1
-	github.com/aws/aws-sdk-go-v2/service/lambda v1.2.2
-	github.com/aws/aws-sdk-go-v2/service/sns v1.2.2
-	github.com/aws/aws-sdk-go-v2/service/sqs v1.3.1
-	github.com/google/go-cmp v0.5.5 // indirect
-	github.com/kr/pretty v0.1.0 // indirect
+	github.com/aws/aws-sdk-go-v2 v1.16.2
+	github.com/aws/aws-sdk-go-v2/config v1.15.3
+	github.com/aws/aws-sdk-go-v2/service/apigateway v1.15.3
+	github.com/aws/aws-sdk-go-v2/service/apigatewayv2 v1.12.3
+	github.com/aws/aws-sdk-go-v2/service/cloudformation v1.20.3
+	github.com/aws/aws-sdk-go-v2/service/cloudwatchlogs v1.15.3
+	github.com/aws/aws-sdk-go-v2/service/dynamodb v1.15.3
+	github.com/aws/aws-sdk-go-v2/service/firehose v1.14.0
+	github.com/aws/aws-sdk-go-v2/service/iam v1.18.3
+	github.com/aws/aws-sdk-go-v2/service/lambda v1.21.1
+	github.com/aws/aws-sdk-go-v2/service/s3 v1.26.4
+	github.com/aws/aws-sdk-go-v2/service/sns v1.17.4
+	github.com/aws/aws-sdk-go-v2/service/sqs v1.18.3
+	github.com/aws/smithy-go v1.11.2
+	github.com/google/go-cmp v0.5.7 // indirect
+	github.com/hashicorp/hcl/v2 v2.10.0
 	github.com/pkg/errors v0.9.1
 	github.com/sirupsen/logrus v1.8.1
 	github.com/stretchr/testify v1.7.0 // indirect
+	github.com/zclconf/go-cty v1.8.0
 	golang.org/x/sys v0.0.0-20210412220455-f1c623a9e750 // indirect
+	golang.org/x/time v0.0.0-20210220033141-f8bda1e9f3ba
 	golang.org/x/xerrors v0.0.0-20200804184101-5ec99f83aff1 // indirect
-	gopkg.in/check.v1 v1.0.0-20180628173108-788fd7840127 // indirect
 	gopkg.in/yaml.v2 v2.3.0 // indirect
+	gopkg.in/yaml.v3 v3.0.0-20200313102051-9f266ea9e77c
 )
@@ -0,0 +1,669 @@
+package aws
+
+import (
+	"context"
+	"sort"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/service/apigateway"
+	apigatewayTypes "github.com/aws/aws-sdk-go-v2/service/apigateway/types"
+	"github.com/cr-norton/tfconvert/pkg/codegen"
+	"github.com/cr-norton/tfconvert/pkg/types"
+	"github.com/hashicorp/hcl/v2/hclwrite"
+	"github.com/zclconf/go-cty/cty"
+)
+
+// restApiConcurrency bounds the methods fetched at once for a single rest api
+const restApiConcurrency = 4
+
+// RestApi is an api gateway rest api with its resources, methods and their
+// integrations, authorizers, deployments and stages. The CloudFormation
+// resources declaring these are converted with their rest api, as their
+// physical ids alone don't identify them.
+type RestApi struct {
+	LogicalID string
+	apigatewayTypes.RestApi
+	// Resources are the resources of the api with their methods, each with
+	// its integration
+	Resources   []apigatewayTypes.Resource
+	Authorizers []apigatewayTypes.Authorizer
+	Deployments []apigatewayTypes.Deployment
+	Stages      []apigatewayTypes.Stage
+	// Body is the OpenAPI definition of an api declared in a template file
+	Body *string
+}
+
+func (aws *Client) GetRestApi(ctx context.Context, logicalID string, restApiID string) (*RestApi, error) {
+	res, err := aws.apigateway.GetRestApi(ctx, &apigateway.GetRestApiInput{
+		RestApiId: &restApiID,
+	})
+	if err != nil {
+		return nil, err
+	}
+	api := &RestApi{
+		LogicalID: logicalID,
+		RestApi: apigatewayTypes.RestApi{
+			Id:                        res.Id,
+			Name:                      res.Name,
+			Description:               res.Description,
+			ApiKeySource:              res.ApiKeySource,
+			BinaryMediaTypes:          res.BinaryMediaTypes,
+			DisableExecuteApiEndpoint: res.DisableExecuteApiEndpoint,
+			EndpointConfiguration:     res.EndpointConfiguration,
+			MinimumCompressionSize:    res.MinimumCompressionSize,
+			Policy:                    res.Policy,
+			Tags:                      res.Tags,
+		},
+	}
+
+	if api.Resources, err = aws.getRestApiResources(ctx, restApiID); err != nil {
+		return nil, err
+	}
+
+	var position *string
+	for {
+		authorizers, err := aws.apigateway.GetAuthorizers(ctx, &apigateway.GetAuthorizersInput{
+			RestApiId: &restApiID,
+			Position:  position,
+		})
+		if err != nil {
+			return nil, err
+		}
+		api.Authorizers = append(api.Authorizers, authorizers.Items...)
+		if authorizers.Position == nil {
+			break
+		}
+		position = authorizers.Position
+	}
+
+	stages, err := aws.apigateway.GetStages(ctx, &apigateway.GetStagesInput{
+		RestApiId: &restApiID,
+	})
+	if err != nil {
+		return nil, err
+	}
+	api.Stages = stages.Item
+
+	deployments := map[string]bool{}
+	for _, stage := range api.Stages {
+		if stage.DeploymentId == nil || deployments[*stage.DeploymentId] {
+			continue
+		}
+		deployments[*stage.DeploymentId] = true
+		deployment, err := aws.apigateway.GetDeployment(ctx, &apigateway.GetDeploymentInput{
+			RestApiId:    &restApiID,
+			DeploymentId: stage.DeploymentId,
+		})
+		if err != nil {
+			return nil, err
+		}
+		api.Deployments = append(api.Deployments, apigatewayTypes.Deployment{
+			Id:          deployment.Id,
+			Description: deployment.Description,
+		})
+	}
+	return api, nil
+}
+
+// getRestApiResources returns the resources of an api ordered by path, with
+// their methods and integrations.
+func (aws *Client) getRestApiResources(ctx context.Context, restApiID string) ([]apigatewayTypes.Resource, error) {
+	resources := []apigatewayTypes.Resource{}
+	var position *string
+	for {
+		res, err := aws.apigateway.GetResources(ctx, &apigateway.GetResourcesInput{
+			RestApiId: &restApiID,
+			Embed:     []string{"methods"},
+			Position:  position,
+		})
+		if err != nil {
+			return nil, err
+		}
+		resources = append(resources, res.Items...)
+		if res.Position == nil {
+			break
+		}
+		position = res.Position
+	}
+	sort.Slice(resources, func(i, j int) bool {
+		return str(resources[i].Path) < str(resources[j].Path)
+	})
+
+	type resourceMethod struct {
+		resource   int
+		httpMethod string
+	}
+	methods := []resourceMethod{}
+	for i, r := range resources {
+		for httpMethod := range r.ResourceMethods {
+			methods = append(methods, resourceMethod{resource: i, httpMethod: httpMethod})
+		}
+	}
+
+	fetched := make([]apigatewayTypes.Method, len(methods))
+	err := forEach(ctx, restApiConcurrency, len(methods), func(ctx context.Context, i int) error {
+		m := methods[i]
+		method, err := aws.apigateway.GetMethod(ctx, &apigateway.GetMethodInput{
+			RestApiId:  &restApiID,
+			ResourceId: resources[m.resource].Id,
+			HttpMethod: &m.httpMethod,
+		})
+		if err != nil {
+			return err
+		}
+		fetched[i] = apigatewayTypes.Method{
+			HttpMethod:          method.HttpMethod,
+			AuthorizationType:   method.AuthorizationType,
+			AuthorizerId:        method.AuthorizerId,
+			AuthorizationScopes: method.AuthorizationScopes,
+			ApiKeyRequired:      method.ApiKeyRequired,
+			OperationName:       method.OperationName,
+			RequestParameters:   method.RequestParameters,
+			RequestModels:       method.RequestModels,
+			RequestValidatorId:  method.RequestValidatorId,
+			MethodResponses:     method.MethodResponses,
+		}
+		if method.MethodIntegration == nil {
+			return nil
+		}
+
+		integration, err := aws.apigateway.GetIntegration(ctx, &apigateway.GetIntegrationInput{
+			RestApiId:  &restApiID,
+			ResourceId: resources[m.resource].Id,
+			HttpMethod: &m.httpMethod,
+		})
+		if err != nil {
+			return err
+		}
+		fetched[i].MethodIntegration = &apigatewayTypes.Integration{
+			Type:                 integration.Type,
+			HttpMethod:           integration.HttpMethod,
+			Uri:                  integration.Uri,
+			Credentials:          integration.Credentials,
+			ConnectionType:       integration.ConnectionType,
+			ConnectionId:         integration.ConnectionId,
+			ContentHandling:      integration.ContentHandling,
+			PassthroughBehavior:  integration.PassthroughBehavior,
+			RequestParameters:    integration.RequestParameters,
+			RequestTemplates:     integration.RequestTemplates,
+			TimeoutInMillis:      integration.TimeoutInMillis,
+			CacheKeyParameters:   integration.CacheKeyParameters,
+			CacheNamespace:       integration.CacheNamespace,
+			IntegrationResponses: integration.IntegrationResponses,
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	for i, m := range methods {
+		resources[m.resource].ResourceMethods[m.httpMethod] = fetched[i]
+	}
+	return resources, nil
+}
+
+func (a RestApi) Key() string {
+	return *a.Id
+}
+
+func (a RestApi) Resource() types.Resource {
+	return types.Resource{
+		Type:       "aws_api_gateway_rest_api",
+		Identifier: a.LogicalID,
+		ImportKey:  *a.Id,
+		OutputKey:  "id",
+	}
+}
+
+func (a RestApi) ReturnValues() map[string]ReturnValue {
+	values := map[string]ReturnValue{
+		"Ref": {"id", str(a.Id)},
+	}
+	if root := a.rootResource(); root != nil {
+		values["RootResourceId"] = ReturnValue{"root_resource_id", str(root.Id)}
+	}
+	return values
+}
+
+func (a RestApi) rootResource() *apigatewayTypes.Resource {
+	for _, r := range a.Resources {
+		if str(r.Path) == "/" {
+			r := r
+			return &r
+		}
+	}
+	return nil
+}
+
+// ChildResources returns the resources, methods, integrations, their
+// responses, authorizers, deployments and stages of the api, which terraform
+// manages as separate resources.
+func (a RestApi) ChildResources() []types.Resource {
+	resources := []types.Resource{}
+	for _, r := range a.Resources {
+		if str(r.Path) != "/" {
+			resources = append(resources, a.resource(r))
+		}
+		for _, httpMethod := range a.httpMethods(r) {
+			m := r.ResourceMethods[httpMethod]
+			resources = append(resources, a.method(r, httpMethod))
+			for _, statusCode := range methodStatusCodes(m) {
+				resources = append(resources, a.methodResponse(r, httpMethod, statusCode))
+			}
+			if m.MethodIntegration != nil {
+				resources = append(resources, a.integration(r, httpMethod))
+				for _, statusCode := range integrationStatusCodes(m.MethodIntegration) {
+					resources = append(resources, a.integrationResponse(r, httpMethod, statusCode))
+				}
+			}
+		}
+	}
+	for _, auth := range a.Authorizers {
+		resources = append(resources, a.authorizer(auth))
+	}
+	for _, d := range a.Deployments {
+		resources = append(resources, a.deployment(d))
+	}
+	for _, s := range a.Stages {
+		resources = append(resources, a.stage(s))
+	}
+	return resources
+}
+
+// pathName names the children of the api after the path of their resource,
+// e.g. Api_orders_id for /orders/{id}. Paths that would share a name, such as
+// /orders/{id} and /orders/id, are suffixed with the id of their resource.
+func (a RestApi) pathName(r apigatewayTypes.Resource) string {
+	names := make([]string, len(a.Resources))
+	index := -1
+	for i, other := range a.Resources {
+		names[i] = a.basePathName(str(other.Path))
+		if str(other.Id) == str(r.Id) {
+			index = i
+		}
+	}
+	if index < 0 {
+		return a.basePathName(str(r.Path))
+	}
+	return uniqueName(names, index, str(r.Id))
+}
+
+func (a RestApi) basePathName(path string) string {
+	path = strings.NewReplacer("{", "", "}", "", "+", "").Replace(strings.Trim(path, "/"))
+	if path == "" {
+		return a.LogicalID
+	}
+	return a.LogicalID + "_" + strings.ReplaceAll(path, "/", "_")
+}
+
+// uniqueName returns names[i], suffixed with an id when another of the names
+// is the same terraform name.
+func uniqueName(names []string, i int, id string) string {
+	for j, name := range names {
+		if j != i && codegen.Name(name) == codegen.Name(names[i]) {
+			return names[i] + "_" + identifierPart(id)
+		}
+	}
+	return names[i]
+}
+
+func (a RestApi) httpMethods(r apigatewayTypes.Resource) []string {
+	methods := []string{}
+	for m := range r.ResourceMethods {
+		methods = append(methods, m)
+	}
+	sort.Strings(methods)
+	return methods
+}
+
+func (a RestApi) resource(r apigatewayTypes.Resource) types.Resource {
+	return types.Resource{
+		Type:       "aws_api_gateway_resource",
+		Identifier: a.pathName(r),
+		ImportKey:  *a.Id + "/" + *r.Id,
+		OutputKey:  "id",
+	}
+}
+
+func (a RestApi) method(r apigatewayTypes.Resource, httpMethod string) types.Resource {
+	return types.Resource{
+		Type:       "aws_api_gateway_method",
+		Identifier: a.pathName(r) + "_" + httpMethod,
+		ImportKey:  *a.Id + "/" + *r.Id + "/" + httpMethod,
+		OutputKey:  "id",
+	}
+}
+
+func (a RestApi) methodResponse(r apigatewayTypes.Resource, httpMethod string, statusCode string) types.Resource {
+	return types.Resource{
+		Type:       "aws_api_gateway_method_response",
+		Identifier: a.pathName(r) + "_" + httpMethod + "_" + statusCode,
+		ImportKey:  *a.Id + "/" + *r.Id + "/" + httpMethod + "/" + statusCode,
+		OutputKey:  "id",
+	}
+}
+
+func (a RestApi) integrationResponse(r apigatewayTypes.Resource, httpMethod string, statusCode string) types.Resource {
+	return types.Resource{
+		Type:       "aws_api_gateway_integration_response",
+		Identifier: a.pathName(r) + "_" + httpMethod + "_" + statusCode,
+		ImportKey:  *a.Id + "/" + *r.Id + "/" + httpMethod + "/" + statusCode,
+		OutputKey:  "id",
+	}
+}
+
+func methodStatusCodes(m apigatewayTypes.Method) []string {
+	codes := []string{}
+	for code := range m.MethodResponses {
+		codes = append(codes, code)
+	}
+	sort.Strings(codes)
+	return codes
+}
+
+func integrationStatusCodes(i *apigatewayTypes.Integration) []string {
+	codes := []string{}
+	for code := range i.IntegrationResponses {
+		codes = append(codes, code)
+	}
+	sort.Strings(codes)
+	return codes
+}
+
+func (a RestApi) integration(r apigatewayTypes.Resource, httpMethod string) types.Resource {
+	return types.Resource{
+		Type:       "aws_api_gateway_integration",
+		Identifier: a.pathName(r) + "_" + httpMethod,
+		ImportKey:  *a.Id + "/" + *r.Id + "/" + httpMethod,
+		OutputKey:  "id",
+	}
+}
+
+func (a RestApi) authorizer(auth apigatewayTypes.Authorizer) types.Resource {
+	return types.Resource{
+		Type:       "aws_api_gateway_authorizer",
+		Identifier: a.LogicalID + "_" + str(auth.Name),
+		ImportKey:  *a.Id + "/" + *auth.Id,
+		OutputKey:  "id",
+	}
+}
+
+func (a RestApi) deployment(d apigatewayTypes.Deployment) types.Resource {
+	// deployments are named after the first stage deploying them
+	name := *d.Id
+	for _, s := range a.Stages {
+		if str(s.DeploymentId) == *d.Id {
+			name = str(s.StageName)
+			break
+		}
+	}
+	return types.Resource{
+		Type:       "aws_api_gateway_deployment",
+		Identifier: a.LogicalID + "_" + name,
+		ImportKey:  *a.Id + "/" + *d.Id,
+		OutputKey:  "id",
+	}
+}
+
+func (a RestApi) stage(s apigatewayTypes.Stage) types.Resource {
+	return types.Resource{
+		Type:       "aws_api_gateway_stage",
+		Identifier: a.LogicalID + "_" + str(s.StageName),
+		ImportKey:  *a.Id + "/" + str(s.StageName),
+		OutputKey:  "stage_name",
+	}
+}
+
+func (a RestApi) WriteHCL(body *hclwrite.Body, stack codegen.Stack) {
+	api := a.Resource()
+	apiID := codegen.ResourceTraversal(api)
+	b := codegen.ResourceBlock(body, api)
+	codegen.SetInterpolation(b, "name", stack, a.Name)
+	setString(b, "description", a.Description)
+	if len(a.BinaryMediaTypes) > 0 {
+		b.SetAttributeValue("binary_media_types", codegen.StringList(a.BinaryMediaTypes))
+	}
+	setInt32(b, "minimum_compression_size", a.MinimumCompressionSize)
+	if a.DisableExecuteApiEndpoint {
+		b.SetAttributeValue("disable_execute_api_endpoint", cty.True)
+	}
+	if a.Policy != nil {
+		// the policy is returned as a json string with escaped quotes
+		b.SetAttributeRaw("policy", codegen.JSONEncodeReferences(stack, strings.ReplaceAll(*a.Policy, `\"`, `"`)))
+	}
+	if a.Body != nil {
+		b.SetAttributeRaw("body", codegen.JSONEncodeReferences(stack, *a.Body))
+	}
+	if a.EndpointConfiguration != nil && len(a.EndpointConfiguration.Types) > 0 {
+		endpointTypes := []string{}
+		for _, t := range a.EndpointConfiguration.Types {
+			endpointTypes = append(endpointTypes, string(t))
+		}
+		b.AppendNewline()
+		eb := b.AppendNewBlock("endpoint_configuration", nil).Body()
+		eb.SetAttributeValue("types", codegen.StringList(endpointTypes))
+	}
+	b.AppendNewline()
+	codegen.SetTags(b, stack)
+
+	// references to resources by id, the root resource by the root_resource_id of the api
+	resourceIDs := map[string]hclwrite.Tokens{}
+	for _, r := range a.Resources {
+		if str(r.Path) == "/" {
+			resourceIDs[*r.Id] = hclwrite.TokensForTraversal(codegen.Traversal(api.Type, codegen.Name(api.Identifier), "root_resource_id"))
+		} else {
+			resourceIDs[*r.Id] = hclwrite.TokensForTraversal(codegen.ResourceTraversal(a.resource(r)))
+		}
+	}
+	authorizerIDs := map[string]hclwrite.Tokens{}
+	for _, auth := range a.Authorizers {
+		authorizerIDs[*auth.Id] = hclwrite.TokensForTraversal(codegen.ResourceTraversal(a.authorizer(auth)))
+	}
+
+	for _, r := range a.Resources {
+		if str(r.Path) != "/" {
+			body.AppendNewline()
+			rb := codegen.ResourceBlock(body, a.resource(r))
+			rb.SetAttributeTraversal("rest_api_id", apiID)
+			if parent, has := resourceIDs[str(r.ParentId)]; has {
+				rb.SetAttributeRaw("parent_id", parent)
+			} else {
+				setString(rb, "parent_id", r.ParentId)
+			}
+			setString(rb, "path_part", r.PathPart)
+		}
+
+		for _, httpMethod := range a.httpMethods(r) {
+			m := r.ResourceMethods[httpMethod]
+			method := a.method(r, httpMethod)
+			body.AppendNewline()
+			mb := codegen.ResourceBlock(body, method)
+			mb.SetAttributeTraversal("rest_api_id", apiID)
+			mb.SetAttributeRaw("resource_id", resourceIDs[*r.Id])
+			mb.SetAttributeValue("http_method", cty.StringVal(httpMethod))
+			setString(mb, "authorization", m.AuthorizationType)
+			if auth, has := authorizerIDs[str(m.AuthorizerId)]; has {
+				mb.SetAttributeRaw("authorizer_id", auth)
+			}
+			if len(m.AuthorizationScopes) > 0 {
+				mb.SetAttributeValue("authorization_scopes", codegen.StringList(m.AuthorizationScopes))
+			}
+			if m.ApiKeyRequired != nil && *m.ApiKeyRequired {
+				mb.SetAttributeValue("api_key_required", cty.True)
+			}
+			setString(mb, "operation_name", m.OperationName)
+			if len(m.RequestParameters) > 0 {
+				params := map[string]cty.Value{}
+				for k, v := range m.RequestParameters {
+					params[k] = cty.BoolVal(v)
+				}
+				mb.SetAttributeValue("request_parameters", cty.MapVal(params))
+			}
+			if len(m.RequestModels) > 0 {
+				mb.SetAttributeValue("request_models", codegen.StringMap(m.RequestModels))
+			}
+			if m.RequestValidatorId != nil {
+				codegen.SetReference(mb, "request_validator_id", stack, *m.RequestValidatorId)
+			}
+
+			methodResponses := map[string]types.Resource{}
+			for _, statusCode := range methodStatusCodes(m) {
+				mr := m.MethodResponses[statusCode]
+				methodResponse := a.methodResponse(r, httpMethod, statusCode)
+				methodResponses[statusCode] = methodResponse
+				body.AppendNewline()
+				rb := codegen.ResourceBlock(body, methodResponse)
+				rb.SetAttributeTraversal("rest_api_id", apiID)
+				rb.SetAttributeRaw("resource_id", resourceIDs[*r.Id])
+				rb.SetAttributeTraversal("http_method", codegen.Traversal(method.Type, codegen.Name(method.Identifier), "http_method"))
+				rb.SetAttributeValue("status_code", cty.StringVal(statusCode))
+				if len(mr.ResponseModels) > 0 {
+					rb.SetAttributeValue("response_models", codegen.StringMap(mr.ResponseModels))
+				}
+				if len(mr.ResponseParameters) > 0 {
+					params := map[string]cty.Value{}
+					for k, v := range mr.ResponseParameters {
+						params[k] = cty.BoolVal(v)
+					}
+					rb.SetAttributeValue("response_parameters", cty.MapVal(params))
+				}
+			}
+
+			i := m.MethodIntegration
+			if i == nil {
+				continue
+			}
+			body.AppendNewline()
+			ib := codegen.ResourceBlock(body, a.integration(r, httpMethod))
+			ib.SetAttributeTraversal("rest_api_id", apiID)
+			ib.SetAttributeRaw("resource_id", resourceIDs[*r.Id])
+			ib.SetAttributeTraversal("http_method", codegen.Traversal(method.Type, codegen.Name(method.Identifier), "http_method"))
+			setString(ib, "integration_http_method", i.HttpMethod)
+			ib.SetAttributeValue("type", cty.StringVal(string(i.Type)))
+			if i.Uri != nil {
+				ib.SetAttributeRaw("uri", invokeArn(stack, *i.Uri))
+			}
+			if i.Credentials != nil {
+				codegen.SetReference(ib, "credentials", stack, *i.Credentials)
+			}
+			if i.ConnectionType != "" {
+				ib.SetAttributeValue("connection_type", cty.StringVal(string(i.ConnectionType)))
+			}
+			setString(ib, "connection_id", i.ConnectionId)
+			if i.ContentHandling != "" {
+				ib.SetAttributeValue("content_handling", cty.StringVal(string(i.ContentHandling)))
+			}
+			setString(ib, "passthrough_behavior", i.PassthroughBehavior)
+			if i.TimeoutInMillis != 0 {
+				ib.SetAttributeValue("timeout_milliseconds", cty.NumberIntVal(int64(i.TimeoutInMillis)))
+			}
+			if len(i.RequestParameters) > 0 {
+				ib.SetAttributeValue("request_parameters", codegen.StringMap(i.RequestParameters))
+			}
+			if len(i.RequestTemplates) > 0 {
+				ib.SetAttributeValue("request_templates", codegen.StringMap(i.RequestTemplates))
+			}
+			if len(i.CacheKeyParameters) > 0 {
+				ib.SetAttributeValue("cache_key_parameters", codegen.StringList(i.CacheKeyParameters))
+			}
+			setString(ib, "cache_namespace", i.CacheNamespace)
+
+			for _, statusCode := range integrationStatusCodes(i) {
+				ir := i.IntegrationResponses[statusCode]
+				integration := a.integration(r, httpMethod)
+				body.AppendNewline()
+				rb := codegen.ResourceBlock(body, a.integrationResponse(r, httpMethod, statusCode))
+				rb.SetAttributeTraversal("rest_api_id", apiID)
+				rb.SetAttributeRaw("resource_id", resourceIDs[*r.Id])
+				// the http_method of the integration creates the response after it
+				rb.SetAttributeTraversal("http_method", codegen.Traversal(integration.Type, codegen.Name(integration.Identifier), "http_method"))
+				if mr, has := methodResponses[statusCode]; has {
+					rb.SetAttributeTraversal("status_code", codegen.Traversal(mr.Type, codegen.Name(mr.Identifier), "status_code"))
+				} else {
+					rb.SetAttributeValue("status_code", cty.StringVal(statusCode))
+				}
+				setString(rb, "selection_pattern", ir.SelectionPattern)
+				if len(ir.ResponseParameters) > 0 {
+					rb.SetAttributeValue("response_parameters", codegen.StringMap(ir.ResponseParameters))
+				}
+				if len(ir.ResponseTemplates) > 0 {
+					rb.SetAttributeValue("response_templates", codegen.StringMap(ir.ResponseTemplates))
+				}
+				if ir.ContentHandling != "" {
+					rb.SetAttributeValue("content_handling", cty.StringVal(string(ir.ContentHandling)))
+				}
+			}
+		}
+	}
+
+	for _, auth := range a.Authorizers {
+		body.AppendNewline()
+		ab := codegen.ResourceBlock(body, a.authorizer(auth))
+		setString(ab, "name", auth.Name)
+		ab.SetAttributeTraversal("rest_api_id", apiID)
+		if auth.Type != "" {
+			ab.SetAttributeValue("type", cty.StringVal(string(auth.Type)))
+		}
+		if auth.AuthorizerUri != nil {
+			ab.SetAttributeRaw("authorizer_uri", invokeArn(stack, *auth.AuthorizerUri))
+		}
+		if auth.AuthorizerCredentials != nil {
+			codegen.SetReference(ab, "authorizer_credentials", stack, *auth.AuthorizerCredentials)
+		}
+		setString(ab, "identity_source", auth.IdentitySource)
+		setString(ab, "identity_validation_expression", auth.IdentityValidationExpression)
+		setInt32(ab, "authorizer_result_ttl_in_seconds", auth.AuthorizerResultTtlInSeconds)
+		if len(auth.ProviderARNs) > 0 {
+			arns := []hclwrite.Tokens{}
+			for _, arn := range auth.ProviderARNs {
+				arns = append(arns, codegen.Reference(stack, arn))
+			}
+			ab.SetAttributeRaw("provider_arns", codegen.List(arns...))
+		}
+	}
+
+	deploymentIDs := map[string]hclwrite.Tokens{}
+	for _, d := range a.Deployments {
+		deployment := a.deployment(d)
+		deploymentIDs[*d.Id] = hclwrite.TokensForTraversal(codegen.ResourceTraversal(deployment))
+		body.AppendNewline()
+		db := codegen.ResourceBlock(body, deployment)
+		db.SetAttributeTraversal("rest_api_id", apiID)
+		setString(db, "description", d.Description)
+	}
+
+	for _, s := range a.Stages {
+		body.AppendNewline()
+		sb := codegen.ResourceBlock(body, a.stage(s))
+		sb.SetAttributeTraversal("rest_api_id", apiID)
+		if deployment, has := deploymentIDs[str(s.DeploymentId)]; has {
+			sb.SetAttributeRaw("deployment_id", deployment)
+		}
+		setString(sb, "stage_name", s.StageName)
+		setString(sb, "description", s.Description)
+		if len(s.Variables) > 0 {
+			sb.SetAttributeRaw("variables", referenceMap(stack, s.Variables))
+		}
+		if s.TracingEnabled {
+			sb.SetAttributeValue("xray_tracing_enabled", cty.True)
+		}
+		sb.AppendNewline()
+		codegen.SetTags(sb, stack)
+	}
+}
+
+// invokeArn returns the tokens for the uri of an integration or authorizer,
+// referencing the invoke_arn of the function it invokes, e.g.
+// arn:aws:apigateway:us-east-1:lambda:path/2015-03-31/functions/arn:aws:lambda:us-east-1:123:function:name/invocations
+func invokeArn(stack codegen.Stack, uri string) hclwrite.Tokens {
+	const functions, invocations = ":lambda:path/2015-03-31/functions/", "/invocations"
+	if i := strings.Index(uri, functions); i >= 0 && strings.HasSuffix(uri, invocations) {
+		arn := strings.TrimSuffix(uri[i+len(functions):], invocations)
+		if res := stack.Lookup(arn); res != nil && res.Type == "aws_lambda_function" {
+			res.OutputKey = "invoke_arn"
+			return hclwrite.TokensForTraversal(codegen.ResourceTraversal(*res))
+		}
+	}
+	return codegen.Reference(stack, uri)
+}
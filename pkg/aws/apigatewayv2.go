@@ -0,0 +1,350 @@
+package aws
+
+import (
+	"context"
+	"strconv"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/service/apigatewayv2"
+	apigatewayv2Types "github.com/aws/aws-sdk-go-v2/service/apigatewayv2/types"
+	"github.com/cr-norton/tfconvert/pkg/codegen"
+	"github.com/cr-norton/tfconvert/pkg/types"
+	"github.com/hashicorp/hcl/v2/hclwrite"
+	"github.com/zclconf/go-cty/cty"
+)
+
+// ApiV2 is an api gateway v2 http or websocket api with its integrations,
+// routes and stages. Like the parts of a rest api, the CloudFormation
+// resources declaring these are converted with their api.
+type ApiV2 struct {
+	LogicalID string
+	apigatewayv2Types.Api
+	Integrations []apigatewayv2Types.Integration
+	Routes       []apigatewayv2Types.Route
+	Stages       []apigatewayv2Types.Stage
+}
+
+func (aws *Client) GetApiV2(ctx context.Context, logicalID string, apiID string) (*ApiV2, error) {
+	res, err := aws.apigatewayv2.GetApi(ctx, &apigatewayv2.GetApiInput{
+		ApiId: &apiID,
+	})
+	if err != nil {
+		return nil, err
+	}
+	api := &ApiV2{
+		LogicalID: logicalID,
+		Api: apigatewayv2Types.Api{
+			ApiId:                     res.ApiId,
+			Name:                      res.Name,
+			ProtocolType:              res.ProtocolType,
+			RouteSelectionExpression:  res.RouteSelectionExpression,
+			ApiKeySelectionExpression: res.ApiKeySelectionExpression,
+			ApiEndpoint:               res.ApiEndpoint,
+			CorsConfiguration:         res.CorsConfiguration,
+			Description:               res.Description,
+			DisableExecuteApiEndpoint: res.DisableExecuteApiEndpoint,
+			Tags:                      res.Tags,
+			Version:                   res.Version,
+		},
+	}
+
+	var token *string
+	for {
+		integrations, err := aws.apigatewayv2.GetIntegrations(ctx, &apigatewayv2.GetIntegrationsInput{
+			ApiId:     &apiID,
+			NextToken: token,
+		})
+		if err != nil {
+			return nil, err
+		}
+		api.Integrations = append(api.Integrations, integrations.Items...)
+		if integrations.NextToken == nil {
+			break
+		}
+		token = integrations.NextToken
+	}
+
+	token = nil
+	for {
+		routes, err := aws.apigatewayv2.GetRoutes(ctx, &apigatewayv2.GetRoutesInput{
+			ApiId:     &apiID,
+			NextToken: token,
+		})
+		if err != nil {
+			return nil, err
+		}
+		api.Routes = append(api.Routes, routes.Items...)
+		if routes.NextToken == nil {
+			break
+		}
+		token = routes.NextToken
+	}
+
+	token = nil
+	for {
+		stages, err := aws.apigatewayv2.GetStages(ctx, &apigatewayv2.GetStagesInput{
+			ApiId:     &apiID,
+			NextToken: token,
+		})
+		if err != nil {
+			return nil, err
+		}
+		api.Stages = append(api.Stages, stages.Items...)
+		if stages.NextToken == nil {
+			break
+		}
+		token = stages.NextToken
+	}
+	return api, nil
+}
+
+func (a ApiV2) Key() string {
+	return *a.ApiId
+}
+
+func (a ApiV2) Resource() types.Resource {
+	return types.Resource{
+		Type:       "aws_apigatewayv2_api",
+		Identifier: a.LogicalID,
+		ImportKey:  *a.ApiId,
+		OutputKey:  "id",
+	}
+}
+
+func (a ApiV2) ReturnValues() map[string]ReturnValue {
+	return map[string]ReturnValue{
+		"Ref":         {"id", str(a.ApiId)},
+		"ApiEndpoint": {"api_endpoint", str(a.ApiEndpoint)},
+	}
+}
+
+// ChildResources returns the integrations, routes and stages of the api,
+// imported by the id of the api and their own id, or name for stages.
+func (a ApiV2) ChildResources() []types.Resource {
+	resources := []types.Resource{}
+	for _, i := range a.Integrations {
+		resources = append(resources, a.integration(i))
+	}
+	for _, r := range a.Routes {
+		resources = append(resources, a.route(r))
+	}
+	for _, s := range a.Stages {
+		resources = append(resources, a.stage(s))
+	}
+	return resources
+}
+
+// keyName names the children of the api after a route key or stage name,
+// e.g. Api_GET_orders_id for GET /orders/{id} and Api_default for $default.
+func (a ApiV2) keyName(key string) string {
+	key = strings.NewReplacer("$", "", "{", "", "}", "", "+", "").Replace(key)
+	key = strings.Trim(strings.NewReplacer(" /", "_", "/", "_", " ", "_").Replace(key), "_")
+	if key == "" {
+		return a.LogicalID
+	}
+	return a.LogicalID + "_" + key
+}
+
+// targetIntegration returns the id of the integration a route targets
+func targetIntegration(r apigatewayv2Types.Route) string {
+	return strings.TrimPrefix(str(r.Target), "integrations/")
+}
+
+// routeName names a route after its key, suffixed with its id when another
+// key would share the name, such as GET /orders/{id} and GET /orders/id.
+func (a ApiV2) routeName(r apigatewayv2Types.Route) string {
+	names := make([]string, len(a.Routes))
+	index := -1
+	for i, other := range a.Routes {
+		names[i] = a.keyName(str(other.RouteKey))
+		if str(other.RouteId) == str(r.RouteId) {
+			index = i
+		}
+	}
+	if index < 0 {
+		return a.keyName(str(r.RouteKey))
+	}
+	return uniqueName(names, index, str(r.RouteId))
+}
+
+// stageName names a stage after its name, numbered when another stage would
+// share the name, such as $default and default.
+func (a ApiV2) stageName(s apigatewayv2Types.Stage) string {
+	names := make([]string, len(a.Stages))
+	index := -1
+	for i, other := range a.Stages {
+		names[i] = a.keyName(str(other.StageName))
+		if str(other.StageName) == str(s.StageName) {
+			index = i
+		}
+	}
+	if index < 0 {
+		return a.keyName(str(s.StageName))
+	}
+	return uniqueName(names, index, strconv.Itoa(index+1))
+}
+
+func (a ApiV2) integration(i apigatewayv2Types.Integration) types.Resource {
+	// integrations are named after the first route targeting them
+	name := a.keyName(*i.IntegrationId)
+	for _, r := range a.Routes {
+		if targetIntegration(r) == *i.IntegrationId {
+			name = a.routeName(r)
+			break
+		}
+	}
+	return types.Resource{
+		Type:       "aws_apigatewayv2_integration",
+		Identifier: name,
+		ImportKey:  *a.ApiId + "/" + *i.IntegrationId,
+		OutputKey:  "id",
+	}
+}
+
+func (a ApiV2) route(r apigatewayv2Types.Route) types.Resource {
+	return types.Resource{
+		Type:       "aws_apigatewayv2_route",
+		Identifier: a.routeName(r),
+		ImportKey:  *a.ApiId + "/" + *r.RouteId,
+		OutputKey:  "id",
+	}
+}
+
+func (a ApiV2) stage(s apigatewayv2Types.Stage) types.Resource {
+	return types.Resource{
+		Type:       "aws_apigatewayv2_stage",
+		Identifier: a.stageName(s),
+		ImportKey:  *a.ApiId + "/" + str(s.StageName),
+		OutputKey:  "id",
+	}
+}
+
+func (a ApiV2) WriteHCL(body *hclwrite.Body, stack codegen.Stack) {
+	api := a.Resource()
+	apiID := codegen.ResourceTraversal(api)
+	b := codegen.ResourceBlock(body, api)
+	codegen.SetInterpolation(b, "name", stack, a.Name)
+	b.SetAttributeValue("protocol_type", cty.StringVal(string(a.ProtocolType)))
+	setString(b, "description", a.Description)
+	setString(b, "route_selection_expression", a.RouteSelectionExpression)
+	setString(b, "api_key_selection_expression", a.ApiKeySelectionExpression)
+	setString(b, "version", a.Version)
+	if a.DisableExecuteApiEndpoint {
+		b.SetAttributeValue("disable_execute_api_endpoint", cty.True)
+	}
+	if c := a.CorsConfiguration; c != nil {
+		b.AppendNewline()
+		cb := b.AppendNewBlock("cors_configuration", nil).Body()
+		if c.AllowCredentials {
+			cb.SetAttributeValue("allow_credentials", cty.True)
+		}
+		for _, attr := range []struct {
+			name   string
+			values []string
+		}{
+			{"allow_headers", c.AllowHeaders},
+			{"allow_methods", c.AllowMethods},
+			{"allow_origins", c.AllowOrigins},
+			{"expose_headers", c.ExposeHeaders},
+		} {
+			if len(attr.values) > 0 {
+				cb.SetAttributeValue(attr.name, codegen.StringList(attr.values))
+			}
+		}
+		if c.MaxAge != 0 {
+			cb.SetAttributeValue("max_age", cty.NumberIntVal(int64(c.MaxAge)))
+		}
+	}
+	b.AppendNewline()
+	codegen.SetTags(b, stack)
+
+	integrations := map[string]types.Resource{}
+	for _, i := range a.Integrations {
+		integration := a.integration(i)
+		integrations[*i.IntegrationId] = integration
+		body.AppendNewline()
+		ib := codegen.ResourceBlock(body, integration)
+		ib.SetAttributeTraversal("api_id", apiID)
+		ib.SetAttributeValue("integration_type", cty.StringVal(string(i.IntegrationType)))
+		setString(ib, "integration_subtype", i.IntegrationSubtype)
+		if i.IntegrationUri != nil {
+			// http apis invoke functions by arn, websocket apis by invocation uri
+			ib.SetAttributeRaw("integration_uri", invokeArn(stack, *i.IntegrationUri))
+		}
+		setString(ib, "integration_method", i.IntegrationMethod)
+		setString(ib, "payload_format_version", i.PayloadFormatVersion)
+		setString(ib, "description", i.Description)
+		if i.ConnectionType != "" {
+			ib.SetAttributeValue("connection_type", cty.StringVal(string(i.ConnectionType)))
+		}
+		setString(ib, "connection_id", i.ConnectionId)
+		if i.CredentialsArn != nil {
+			codegen.SetReference(ib, "credentials_arn", stack, *i.CredentialsArn)
+		}
+		if i.ContentHandlingStrategy != "" {
+			ib.SetAttributeValue("content_handling_strategy", cty.StringVal(string(i.ContentHandlingStrategy)))
+		}
+		if i.PassthroughBehavior != "" {
+			ib.SetAttributeValue("passthrough_behavior", cty.StringVal(string(i.PassthroughBehavior)))
+		}
+		setString(ib, "template_selection_expression", i.TemplateSelectionExpression)
+		if i.TimeoutInMillis != 0 {
+			ib.SetAttributeValue("timeout_milliseconds", cty.NumberIntVal(int64(i.TimeoutInMillis)))
+		}
+		if len(i.RequestParameters) > 0 {
+			ib.SetAttributeValue("request_parameters", codegen.StringMap(i.RequestParameters))
+		}
+		if len(i.RequestTemplates) > 0 {
+			ib.SetAttributeValue("request_templates", codegen.StringMap(i.RequestTemplates))
+		}
+	}
+
+	for _, r := range a.Routes {
+		body.AppendNewline()
+		rb := codegen.ResourceBlock(body, a.route(r))
+		rb.SetAttributeTraversal("api_id", apiID)
+		setString(rb, "route_key", r.RouteKey)
+		if integration, has := integrations[targetIntegration(r)]; has {
+			rb.SetAttributeRaw("target", codegen.Interpolate([]codegen.InterpolationPart{{Literal: "integrations/"}, {Resource: &integration}}))
+		} else {
+			setString(rb, "target", r.Target)
+		}
+		if r.AuthorizationType != "" {
+			rb.SetAttributeValue("authorization_type", cty.StringVal(string(r.AuthorizationType)))
+		}
+		setString(rb, "authorizer_id", r.AuthorizerId)
+		if len(r.AuthorizationScopes) > 0 {
+			rb.SetAttributeValue("authorization_scopes", codegen.StringList(r.AuthorizationScopes))
+		}
+		if r.ApiKeyRequired {
+			rb.SetAttributeValue("api_key_required", cty.True)
+		}
+		setString(rb, "operation_name", r.OperationName)
+		setString(rb, "route_response_selection_expression", r.RouteResponseSelectionExpression)
+	}
+
+	for _, s := range a.Stages {
+		body.AppendNewline()
+		sb := codegen.ResourceBlock(body, a.stage(s))
+		sb.SetAttributeTraversal("api_id", apiID)
+		setString(sb, "name", s.StageName)
+		setString(sb, "description", s.Description)
+		if s.AutoDeploy {
+			sb.SetAttributeValue("auto_deploy", cty.True)
+		} else {
+			// deployments of apis not deployed automatically are left to terraform
+			setString(sb, "deployment_id", s.DeploymentId)
+		}
+		if len(s.StageVariables) > 0 {
+			sb.SetAttributeRaw("stage_variables", referenceMap(stack, s.StageVariables))
+		}
+		if l := s.AccessLogSettings; l != nil && l.DestinationArn != nil {
+			sb.AppendNewline()
+			lb := sb.AppendNewBlock("access_log_settings", nil).Body()
+			codegen.SetReference(lb, "destination_arn", stack, *l.DestinationArn)
+			setString(lb, "format", l.Format)
+		}
+		sb.AppendNewline()
+		codegen.SetTags(sb, stack)
+	}
+}
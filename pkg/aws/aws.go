@@ -2,138 +2,380 @@ package aws
 
 import (
 	"context"
+	"path"
+	"sort"
+	"strings"
+	"sync/atomic"
 
 	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/apigateway"
+	"github.com/aws/aws-sdk-go-v2/service/apigatewayv2"
 	"github.com/aws/aws-sdk-go-v2/service/cloudformation"
 	cloudformationTypes "github.com/aws/aws-sdk-go-v2/service/cloudformation/types"
 	"github.com/aws/aws-sdk-go-v2/service/cloudwatchlogs"
 	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
 	"github.com/aws/aws-sdk-go-v2/service/firehose"
 	"github.com/aws/aws-sdk-go-v2/service/iam"
+	iamTypes "github.com/aws/aws-sdk-go-v2/service/iam/types"
 	"github.com/aws/aws-sdk-go-v2/service/lambda"
 	lambdaTypes "github.com/aws/aws-sdk-go-v2/service/lambda/types"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
 	"github.com/aws/aws-sdk-go-v2/service/sns"
 	"github.com/aws/aws-sdk-go-v2/service/sqs"
 	sqsTypes "github.com/aws/aws-sdk-go-v2/service/sqs/types"
+	"github.com/aws/smithy-go"
+	"github.com/aws/smithy-go/middleware"
 	"github.com/cr-norton/tfconvert/pkg/types"
 	"github.com/pkg/errors"
 	log "github.com/sirupsen/logrus"
 )
 
+// nestedStackType is the resource type of a nested stack
+const nestedStackType = "AWS::CloudFormation::Stack"
+
+// rolePolicyConcurrency bounds the policies fetched at once for a single role
+const rolePolicyConcurrency = 4
+
 type Client struct {
+	apigateway     *apigateway.Client
+	apigatewayv2   *apigatewayv2.Client
 	cloudformation *cloudformation.Client
 	dynamodb       *dynamodb.Client
 	iam            *iam.Client
 	firehose       *firehose.Client
 	lambda         *lambda.Client
 	logs           *cloudwatchlogs.Client
+	s3             *s3.Client
 	sqs            *sqs.Client
 	sns            *sns.Client
 }
 
-// New ...
-func New(region string) (*Client, error) {
-	cfg, err := config.LoadDefaultConfig(context.Background(), config.WithRegion(region))
+// New configures a client for the region of the options. Calls are retried
+// with backoff and rate limited per service, slowing down when throttled.
+func New(options types.Options) (*Client, error) {
+	maxRetries, rateLimit := options.MaxRetries, options.RateLimit
+	if maxRetries < 0 {
+		maxRetries = types.DefaultMaxRetries
+	}
+	if rateLimit <= 0 {
+		rateLimit = types.DefaultRateLimit
+	}
+
+	limiter := newAdaptiveLimiter(rateLimit)
+	cfg, err := config.LoadDefaultConfig(context.Background(),
+		config.WithRegion(options.Region),
+		config.WithRetryer(newRetryer(maxRetries)),
+		config.WithAPIOptions([]func(*middleware.Stack) error{limiter.middleware}),
+	)
 	if err != nil {
 		return nil, err
 	}
 
 	return &Client{
+		apigateway:     apigateway.NewFromConfig(cfg),
+		apigatewayv2:   apigatewayv2.NewFromConfig(cfg),
 		cloudformation: cloudformation.NewFromConfig(cfg),
 		dynamodb:       dynamodb.NewFromConfig(cfg),
 		iam:            iam.NewFromConfig(cfg),
 		firehose:       firehose.NewFromConfig(cfg),
 		lambda:         lambda.NewFromConfig(cfg),
 		logs:           cloudwatchlogs.NewFromConfig(cfg),
+		s3:             s3.NewFromConfig(cfg),
 		sqs:            sqs.NewFromConfig(cfg),
 		sns:            sns.NewFromConfig(cfg),
 	}, nil
 }
 
 func (aws *Client) GetStack(ctx context.Context, options types.Options) (*Stack, error) {
-	resources, err := aws.GetStackResources(ctx, options.StackName)
+	flatten := options.NestedStacks != types.NestedStacksModules
+	resources, flattened, err := aws.listStackResources(ctx, options.StackName, flatten)
 	if err != nil {
 		return nil, err
 	}
 
-	stackres := &StackResources{}
+	supported := []cloudformationTypes.StackResourceSummary{}
+	nested := []cloudformationTypes.StackResourceSummary{}
+	versions := []cloudformationTypes.StackResourceSummary{}
 	for _, r := range resources {
-		switch *r.ResourceType {
-		case "AWS::DynamoDB::Table":
-			table, err := aws.GetDynamoTable(ctx, *r.LogicalResourceId, *r.PhysicalResourceId)
-			if err != nil {
-				return nil, err
+		if *r.ResourceType == nestedStackType {
+			if r.PhysicalResourceId != nil {
+				nested = append(nested, r)
 			}
-			stackres.DynamoTables = append(stackres.DynamoTables, *table)
-		case "AWS::IAM::Role":
-			role, err := aws.GetRole(ctx, *r.LogicalResourceId, *r.PhysicalResourceId)
-			if err != nil {
-				return nil, errors.Wrap(err, "unable to get IAM role")
-			}
-			stackres.Roles = append(stackres.Roles, *role)
-		case "AWS::KinesisFirehose::DeliveryStream":
-			stream, err := aws.GetFirehoseDeliveryStream(ctx, *r.LogicalResourceId, *r.PhysicalResourceId)
-			if err != nil {
-				return nil, err
-			}
-			stackres.FirehoseDeliveryStreams = append(stackres.FirehoseDeliveryStreams, *stream)
-		case "AWS::Lambda::Function":
-			function, err := aws.GetLambdaFunction(ctx, *r.LogicalResourceId, *r.PhysicalResourceId)
-			if err != nil {
-				return nil, err
-			}
-			stackres.LambdaFunctions = append(stackres.LambdaFunctions, *function)
-		case "AWS::Lambda::EventSourceMapping":
-			event, err := aws.GetLambdaEventSource(ctx, *r.LogicalResourceId, *r.PhysicalResourceId)
+		} else if *r.ResourceType == lambdaVersionType {
+			versions = append(versions, r)
+		} else if _, has := Handler(*r.ResourceType); has {
+			supported = append(supported, r)
+		} else if !ignored[*r.ResourceType] {
+			log.WithFields(log.Fields{
+				"resource_type": *r.ResourceType,
+				"logical_id":    *r.LogicalResourceId,
+				"physical_id":   *r.PhysicalResourceId,
+			}).Warn("unsupported aws resource")
+		}
+	}
+
+	stackInterface, err := aws.GetStackInterface(ctx, options.StackName)
+	if err != nil {
+		return nil, err
+	}
+	partition := stackPartition(stackInterface.StackID)
+
+	fetched := make([]StackResource, len(supported))
+	failed := make([]error, len(supported))
+	var done int64
+	err = forEach(ctx, options.Concurrency, len(supported), func(ctx context.Context, i int) error {
+		r := supported[i]
+		h, _ := Handler(*r.ResourceType)
+		res, err := h.Fetch(ctx, aws, *r.LogicalResourceId, *r.PhysicalResourceId)
+		if err != nil && options.ContinueOnError && ctx.Err() == nil {
+			log.WithFields(log.Fields{
+				"resource_type": *r.ResourceType,
+				"logical_id":    *r.LogicalResourceId,
+				"physical_id":   *r.PhysicalResourceId,
+			}).Warnf("unable to fetch resource: %v", err)
+			failed[i] = err
+			return nil
+		}
+		if err != nil {
+			return errors.Wrapf(err, "unable to fetch %s %s", *r.ResourceType, *r.LogicalResourceId)
+		}
+		fetched[i] = res
+
+		log.WithFields(log.Fields{
+			"resource_type": *r.ResourceType,
+			"logical_id":    *r.LogicalResourceId,
+		}).Infof("fetched resource %d/%d", atomic.AddInt64(&done, 1), len(supported))
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// results are stored in stack order regardless of which fetch finished first
+	stackres := &StackResources{ByType: map[string][]StackResource{}}
+	failures := []Failure{}
+	for i, r := range supported {
+		if failed[i] != nil {
+			failures = append(failures, Failure{
+				ResourceType: *r.ResourceType,
+				LogicalID:    *r.LogicalResourceId,
+				PhysicalID:   *r.PhysicalResourceId,
+				Error:        failed[i].Error(),
+			})
+			continue
+		}
+		if p, ok := fetched[i].(partitioned); ok {
+			fetched[i] = p.inPartition(partition)
+		}
+		h, _ := Handler(*r.ResourceType)
+		if err := stackres.add(h, fetched[i]); err != nil {
+			return nil, err
+		}
+	}
+	fetchedVersions, versionFailures, err := aws.getLambdaVersions(ctx, versions, options)
+	if err != nil {
+		return nil, err
+	}
+	failures = append(failures, versionFailures...)
+	if err := aws.resolveLambdaVersions(ctx, stackres, fetchedVersions, options.Concurrency); err != nil {
+		return nil, err
+	}
+	if err := aws.resolveLambdaPermissions(ctx, stackres, options.Concurrency); err != nil {
+		return nil, err
+	}
+
+	serviceName := options.ServiceName
+	if serviceName == "" {
+		serviceName = options.StackName
+	}
+
+	template, err := aws.GetTemplate(ctx, options.StackName)
+	if err != nil {
+		return nil, err
+	}
+
+	var exports []Export
+	if options.ExportReferences != types.ExportReferencesNone {
+		names, err := importValueNames(template, stackName(stackInterface.StackID), stackInterface.StackID, stackInterface.Parameters)
+		if err != nil {
+			return nil, err
+		}
+		for _, f := range flattened {
+			nestedNames, err := importValueNames(f.Template, f.Name, f.StackID, f.Parameters)
 			if err != nil {
 				return nil, err
 			}
-			stackres.LambdaEventSources = append(stackres.LambdaEventSources, *event)
-		case "AWS::Logs::LogGroup":
-			logs, err := aws.GetLogGroup(ctx, *r.LogicalResourceId, *r.PhysicalResourceId)
-			if err != nil {
-				return nil, err
+			names = append(names, nestedNames...)
+		}
+		if exports, err = aws.GetImportedExports(ctx, names); err != nil {
+			return nil, err
+		}
+	}
+
+	stack := &Stack{
+		Name:             options.StackName,
+		ServiceName:      serviceName,
+		AdditionalTags:   options.AdditionalTags,
+		Index:            index(stackres),
+		StackID:          stackInterface.StackID,
+		Template:         template,
+		Parameters:       stackInterface.Parameters,
+		Outputs:          stackInterface.Outputs,
+		Flattened:        flattened,
+		Exports:          exports,
+		ExportReferences: NewExportReferences(options),
+		StackResources:   stackres,
+		Failures:         failures,
+	}
+	if err := stack.applyTemplate(); err != nil {
+		return nil, errors.Wrapf(err, "unable to apply template of %s", options.StackName)
+	}
+
+	for _, r := range nested {
+		nestedOptions := options
+		nestedOptions.StackName = *r.PhysicalResourceId
+		nestedOptions.ServiceName = serviceName
+		child, err := aws.GetStack(ctx, nestedOptions)
+		if err != nil {
+			return nil, errors.Wrapf(err, "unable to load nested stack %s", *r.LogicalResourceId)
+		}
+		child.Name = stackName(*r.PhysicalResourceId)
+		stack.Nested = append(stack.Nested, child)
+	}
+	return stack, nil
+}
+
+// listStackResources lists the resources of a stack. When flattening, the
+// resources of nested stacks replace the nested stack, their logical ids
+// prefixed with its logical id and an underscore so they stay unique, and the
+// nested stacks are returned with the prefix of their resources and the
+// template resolving their references.
+func (aws *Client) listStackResources(ctx context.Context, stack string, flatten bool) ([]cloudformationTypes.StackResourceSummary, []FlattenedStack, error) {
+	resources, err := aws.GetStackResources(ctx, stack)
+	if err != nil || !flatten {
+		return resources, nil, err
+	}
+
+	flattened := []cloudformationTypes.StackResourceSummary{}
+	nested := []FlattenedStack{}
+	for _, r := range resources {
+		if *r.ResourceType != nestedStackType || r.PhysicalResourceId == nil {
+			flattened = append(flattened, r)
+			continue
+		}
+
+		children, grandchildren, err := aws.listStackResources(ctx, *r.PhysicalResourceId, true)
+		if err != nil {
+			return nil, nil, errors.Wrapf(err, "unable to list nested stack %s", *r.LogicalResourceId)
+		}
+		prefix := *r.LogicalResourceId + "_"
+		for _, c := range children {
+			logicalID := prefix + *c.LogicalResourceId
+			c.LogicalResourceId = &logicalID
+			flattened = append(flattened, c)
+		}
+
+		template, err := aws.GetTemplate(ctx, *r.PhysicalResourceId)
+		if err != nil {
+			return nil, nil, err
+		}
+		stackInterface, err := aws.GetStackInterface(ctx, *r.PhysicalResourceId)
+		if err != nil {
+			return nil, nil, err
+		}
+		nested = append(nested, FlattenedStack{
+			Prefix:     prefix,
+			Name:       stackName(*r.PhysicalResourceId),
+			StackID:    *r.PhysicalResourceId,
+			Template:   template,
+			Parameters: stackInterface.Parameters,
+		})
+		for _, g := range grandchildren {
+			g.Prefix = prefix + g.Prefix
+			nested = append(nested, g)
+		}
+	}
+	return flattened, nested, nil
+}
+
+// stackName returns the name of a stack from its id, which is an arn such as
+// arn:aws:cloudformation:us-east-1:123456789012:stack/name/guid.
+func stackName(stackID string) string {
+	parts := strings.Split(stackID, "/")
+	if len(parts) < 2 {
+		return stackID
+	}
+	return parts[1]
+}
+
+// StackNames expands the glob patterns among names to the matching stacks of
+// the account, keeping the order of names and dropping duplicates.
+func (aws *Client) StackNames(ctx context.Context, names []string) ([]string, error) {
+	var existing []string
+	seen := map[string]bool{}
+	stacks := []string{}
+	for _, name := range names {
+		if !strings.ContainsAny(name, "*?[") {
+			if !seen[name] {
+				seen[name] = true
+				stacks = append(stacks, name)
 			}
-			stackres.LogGroups = append(stackres.LogGroups, *logs)
-		case "AWS::SQS::Queue":
-			queue, err := aws.GetQueue(ctx, *r.LogicalResourceId, *r.PhysicalResourceId)
-			if err != nil {
-				return nil, err
+			continue
+		}
+
+		if existing == nil {
+			var err error
+			if existing, err = aws.ListStacks(ctx); err != nil {
+				return nil, errors.Wrap(err, "unable to list stacks")
 			}
-			stackres.Queues = append(stackres.Queues, *queue)
-		case "AWS::SNS::Topic":
-			topic, err := aws.GetTopic(ctx, *r.LogicalResourceId, *r.PhysicalResourceId)
+		}
+		matched := false
+		for _, stack := range existing {
+			ok, err := path.Match(name, stack)
 			if err != nil {
-				return nil, err
+				return nil, errors.Wrapf(err, "invalid stack pattern %q", name)
 			}
-			stackres.Topics = append(stackres.Topics, *topic)
-		case "AWS::SNS::Subscription":
-			subscription, err := aws.GetTopicSubscription(ctx, *r.LogicalResourceId, *r.PhysicalResourceId)
-			if err != nil {
-				return nil, err
+			if ok {
+				matched = true
+				if !seen[stack] {
+					seen[stack] = true
+					stacks = append(stacks, stack)
+				}
 			}
-			stackres.TopicSubscriptions = append(stackres.TopicSubscriptions, *subscription)
-		case "AWS::ApiGateway::Authorizer", "AWS::ApiGateway::Deployment", "AWS::ApiGateway::Method", "AWS::ApiGateway::Resource", "AWS::ApiGateway::RestApi":
-			continue
-		case "AWS::ApiGatewayV2::Api", "AWS::ApiGatewayV2::Integration", "AWS::ApiGatewayV2::Route", "AWS::ApiGatewayV2::Stage":
-			continue
-		default:
-			log.WithFields(log.Fields{
-				"resource_type": *r.ResourceType,
-				"logical_id":    *r.LogicalResourceId,
-				"physical_id":   *r.PhysicalResourceId,
-			}).Warn("unsupported aws resource")
+		}
+		if !matched {
+			return nil, errors.Errorf("no stack matches %q", name)
 		}
 	}
+	return stacks, nil
+}
 
-	stack := &Stack{
-		Name:           options.StackName,
-		ServiceName:    options.ServiceName,
-		AdditionalTags: options.AdditionalTags,
-		Index:          index(stackres),
-		StackResources: stackres,
+// ListStacks returns the names of the stacks of the account that haven't been deleted.
+func (aws *Client) ListStacks(ctx context.Context) ([]string, error) {
+	input := &cloudformation.ListStacksInput{}
+	for _, status := range cloudformationTypes.StackStatusDeleteComplete.Values() {
+		if status != cloudformationTypes.StackStatusDeleteComplete {
+			input.StackStatusFilter = append(input.StackStatusFilter, status)
+		}
 	}
-	return stack, nil
+	names := []string{}
+	for {
+		res, err := aws.cloudformation.ListStacks(ctx, input)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, summary := range res.StackSummaries {
+			names = append(names, *summary.StackName)
+		}
+		if res.NextToken != nil {
+			input.NextToken = res.NextToken
+		} else {
+			break
+		}
+	}
+	sort.Strings(names)
+	return names, nil
 }
 
 func (aws *Client) GetStackResources(ctx context.Context, stackName string) ([]cloudformationTypes.StackResourceSummary, error) {
@@ -188,15 +430,23 @@ func (aws *Client) GetRole(ctx context.Context, logicalID string, roleName strin
 		return nil, err
 	}
 
-	for _, pname := range rolePolicies.PolicyNames {
+	documents := make([]string, len(rolePolicies.PolicyNames))
+	err = forEach(ctx, rolePolicyConcurrency, len(rolePolicies.PolicyNames), func(ctx context.Context, i int) error {
 		policy, err := aws.iam.GetRolePolicy(ctx, &iam.GetRolePolicyInput{
 			RoleName:   &roleName,
-			PolicyName: &pname,
+			PolicyName: &rolePolicies.PolicyNames[i],
 		})
 		if err != nil {
-			return nil, err
+			return err
 		}
-		r.PolicyDocuments[pname] = *policy.PolicyDocument
+		documents[i] = *policy.PolicyDocument
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	for i, pname := range rolePolicies.PolicyNames {
+		r.PolicyDocuments[pname] = documents[i]
 	}
 
 	attachedPolicies, err := aws.iam.ListAttachedRolePolicies(ctx, &iam.ListAttachedRolePoliciesInput{
@@ -206,14 +456,19 @@ func (aws *Client) GetRole(ctx context.Context, logicalID string, roleName strin
 		return nil, err
 	}
 
-	for _, apolicy := range attachedPolicies.AttachedPolicies {
+	r.AttachedPolicies = make([]iamTypes.Policy, len(attachedPolicies.AttachedPolicies))
+	err = forEach(ctx, rolePolicyConcurrency, len(attachedPolicies.AttachedPolicies), func(ctx context.Context, i int) error {
 		policy, err := aws.iam.GetPolicy(ctx, &iam.GetPolicyInput{
-			PolicyArn: apolicy.PolicyArn,
+			PolicyArn: attachedPolicies.AttachedPolicies[i].PolicyArn,
 		})
 		if err != nil {
-			return nil, err
+			return err
 		}
-		r.AttachedPolicies = append(r.AttachedPolicies, *policy.Policy)
+		r.AttachedPolicies[i] = *policy.Policy
+		return nil
+	})
+	if err != nil {
+		return nil, err
 	}
 
 	return r, nil
@@ -239,10 +494,17 @@ func (aws *Client) GetLambdaFunction(ctx context.Context, logicalID string, func
 	if err != nil {
 		return nil, err
 	}
-	return &LambdaFunctionConfiguration{
+	function := &LambdaFunctionConfiguration{
 		LogicalID:             logicalID,
 		FunctionConfiguration: *res.Configuration,
-	}, nil
+	}
+	if res.Code != nil {
+		function.ImageUri = res.Code.ImageUri
+	}
+	if res.Concurrency != nil {
+		function.ReservedConcurrentExecutions = res.Concurrency.ReservedConcurrentExecutions
+	}
+	return function, nil
 }
 
 func (aws *Client) GetLambdaEventSource(ctx context.Context, logicalID string, uuid string) (*LambdaEventSource, error) {
@@ -285,9 +547,12 @@ func (aws *Client) GetLogGroup(ctx context.Context, logicalID string, logGroupNa
 	res, err := aws.logs.DescribeLogGroups(ctx, &cloudwatchlogs.DescribeLogGroupsInput{
 		LogGroupNamePrefix: &logGroupName,
 	})
-	if err != nil || len(res.LogGroups) == 0 {
+	if err != nil {
 		return nil, err
 	}
+	if len(res.LogGroups) == 0 {
+		return nil, errors.Errorf("log group %s not found", logGroupName)
+	}
 	return &LogGroup{
 		LogicalID: logicalID,
 		LogGroup:  res.LogGroups[0],
@@ -304,6 +569,7 @@ func (aws *Client) GetQueue(ctx context.Context, logicalID string, queueURL stri
 	}
 	return &Queue{
 		LogicalID:  logicalID,
+		URL:        queueURL,
 		Attributes: res.Attributes,
 	}, nil
 }
@@ -333,3 +599,10 @@ func (aws *Client) GetTopicSubscription(ctx context.Context, logicalID string, s
 		Attributes: res.Attributes,
 	}, nil
 }
+
+// hasErrorCode reports whether err is an error of the aws api with the code,
+// such as the errors returned for parts of a resource that aren't configured.
+func hasErrorCode(err error, code string) bool {
+	var apiErr smithy.APIError
+	return errors.As(err, &apiErr) && apiErr.ErrorCode() == code
+}
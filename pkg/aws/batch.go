@@ -0,0 +1,176 @@
+package aws
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/cr-norton/tfconvert/pkg/codegen"
+	"github.com/cr-norton/tfconvert/pkg/types"
+	"github.com/hashicorp/hcl/v2/hclwrite"
+	"github.com/zclconf/go-cty/cty"
+)
+
+// Batch is a set of stacks converted together, each into a module of its own.
+// A resource of one stack referenced by another is passed between their
+// modules as an output of the one and a variable of the other, instead of
+// hardcoding its identifier.
+type Batch struct {
+	Stacks []*Stack
+	// inputs are the variables of every module, keyed by stack and variable name
+	inputs map[string]map[string]crossReference
+}
+
+type crossReference struct {
+	stack    *Stack
+	resource types.Resource
+}
+
+// NewBatch links the stacks so each one looks up resources in the others.
+func NewBatch(stacks []*Stack) *Batch {
+	b := &Batch{
+		Stacks: stacks,
+		inputs: map[string]map[string]crossReference{},
+	}
+	for _, s := range stacks {
+		s.batch = b
+		b.inputs[s.Name] = map[string]crossReference{}
+	}
+	return b
+}
+
+// lookup finds id in the other stacks of the batch and records the variable
+// the stack needs to reference it.
+func (b *Batch) lookup(from Stack, id string) *types.Resource {
+	for _, s := range b.Stacks {
+		if s.Name == from.Name {
+			continue
+		}
+		r, has := s.Index[id]
+		if !has {
+			continue
+		}
+		name := strings.Join([]string{codegen.Name(s.Name), codegen.Name(r.Identifier), r.OutputKey}, "_")
+		b.inputs[from.Name][name] = crossReference{stack: s, resource: r}
+		return &types.Resource{Type: "var", Identifier: name}
+	}
+	return nil
+}
+
+// ModuleFiles returns the variables and outputs of the module of a stack. The
+// terraform of every stack in the batch must be generated first, as that is
+// when references between them are found.
+func (b *Batch) ModuleFiles(stack Stack) (map[string]string, error) {
+	variables := hclwrite.NewFile()
+	for i, name := range sortedNames(b.inputs[stack.Name]) {
+		if i > 0 {
+			variables.Body().AppendNewline()
+		}
+		vb := variables.Body().AppendNewBlock("variable", []string{name}).Body()
+		vb.SetAttributeRaw("type", hclwrite.TokensForTraversal(codegen.Traversal("string")))
+	}
+
+	outputs := map[string]types.Resource{}
+	for _, refs := range b.inputs {
+		for name, ref := range refs {
+			if ref.stack.Name == stack.Name {
+				outputs[name] = ref.resource
+			}
+		}
+	}
+	names := []string{}
+	for name := range outputs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	out := hclwrite.NewFile()
+	for i, name := range names {
+		if i > 0 {
+			out.Body().AppendNewline()
+		}
+		ob := out.Body().AppendNewBlock("output", []string{name}).Body()
+		ob.SetAttributeTraversal("value", codegen.ResourceTraversal(outputs[name]))
+	}
+
+	files := map[string]string{}
+	for name, f := range map[string]*hclwrite.File{"variables.tf": variables, "outputs.tf": out} {
+		content, err := codegen.Format(name, string(f.Bytes()))
+		if err != nil {
+			return nil, err
+		}
+		files[name] = content
+	}
+	return files, nil
+}
+
+// RootFiles returns the root module calling the module of every stack from
+// its subdirectory and wiring the outputs of each to the variables of others.
+// The parameters of the stacks are variables of the root module, prefixed
+// with the name of their module.
+func (b *Batch) RootFiles() (map[string]string, error) {
+	main, variables, values := hclwrite.NewFile(), hclwrite.NewFile(), hclwrite.NewFile()
+	for i, s := range b.Stacks {
+		if i > 0 {
+			main.Body().AppendNewline()
+		}
+		module := codegen.Name(s.Name)
+		mb := main.Body().AppendNewBlock("module", []string{module}).Body()
+		mb.SetAttributeValue("source", cty.StringVal("./"+s.Name))
+		for _, p := range s.Parameters {
+			name := module + "_" + p.Name()
+			mb.SetAttributeTraversal(p.Name(), codegen.Traversal("var", name))
+
+			if len(variables.Body().Blocks()) > 0 {
+				variables.Body().AppendNewline()
+			}
+			writeVariable(variables.Body(), name, p)
+			parameterValue{name: name, Parameter: p}.WriteHCL(values.Body(), s)
+		}
+		for _, name := range sortedNames(b.inputs[s.Name]) {
+			ref := b.inputs[s.Name][name]
+			mb.SetAttributeTraversal(name, codegen.Traversal("module", codegen.Name(ref.stack.Name), name))
+		}
+	}
+
+	files := map[string]string{}
+	for name, f := range map[string]*hclwrite.File{"main.tf": main, "variables.tf": variables, "terraform.tfvars": values} {
+		content, err := codegen.Format(name, string(f.Bytes()))
+		if err != nil {
+			return nil, err
+		}
+		files[name] = content
+	}
+	return files, nil
+}
+
+// Resources returns the terraform resources of every stack, addressed within
+// the module of their stack.
+func (b *Batch) Resources() []types.Resource {
+	resources := []types.Resource{}
+	for _, s := range b.Stacks {
+		for _, r := range s.Resources() {
+			r.Module = s.Name
+			resources = append(resources, r)
+		}
+	}
+	return resources
+}
+
+// StateResources returns the state resources of every stack keyed by the
+// module of their stack.
+func (b *Batch) StateResources() map[string][]codegen.StateResource {
+	modules := map[string][]codegen.StateResource{}
+	for _, s := range b.Stacks {
+		modules[s.Name] = s.StateResources()
+	}
+	return modules
+}
+
+func sortedNames(refs map[string]crossReference) []string {
+	names := []string{}
+	for name := range refs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
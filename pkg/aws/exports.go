@@ -0,0 +1,311 @@
+package aws
+
+import (
+	"context"
+	"sort"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/service/cloudformation"
+	"github.com/cr-norton/tfconvert/pkg/cfn"
+	"github.com/cr-norton/tfconvert/pkg/codegen"
+	"github.com/cr-norton/tfconvert/pkg/types"
+	"github.com/hashicorp/hcl/v2/hclwrite"
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+	"github.com/zclconf/go-cty/cty"
+)
+
+// Export is a value exported by another stack and imported by this one with
+// Fn::ImportValue.
+type Export struct {
+	Name           string `json:"name"`
+	Value          string `json:"value"`
+	ExportingStack string `json:"exporting_stack"`
+	// OutputKey is the output of the exporting stack holding the value
+	OutputKey string `json:"output_key"`
+}
+
+// ExportReferences configures how the stack references imported exports.
+type ExportReferences struct {
+	Mode string
+	// Backend and Config configure terraform_remote_state, every {stack} in
+	// the config is replaced with the name of the exporting stack
+	Backend string
+	Config  map[string]string
+}
+
+// NewExportReferences returns the export references of the options, using
+// aws_cloudformation_export data sources unless configured otherwise.
+func NewExportReferences(options types.Options) ExportReferences {
+	refs := ExportReferences{
+		Mode:    options.ExportReferences,
+		Backend: options.RemoteStateBackend,
+		Config:  options.RemoteStateConfig,
+	}
+	if refs.Mode == "" {
+		refs.Mode = types.ExportReferencesData
+	}
+	if refs.Backend == "" {
+		refs.Backend = "local"
+		if refs.Config == nil {
+			refs.Config = map[string]string{"path": "../{stack}/terraform.tfstate"}
+		}
+	}
+	return refs
+}
+
+// reference returns the resource referencing an export, or nil when exports
+// are written as literals.
+func (refs ExportReferences) reference(e Export) *types.Resource {
+	switch refs.Mode {
+	case types.ExportReferencesData:
+		return &types.Resource{Type: "data.aws_cloudformation_export", Identifier: e.Name, OutputKey: "value"}
+	case types.ExportReferencesRemoteState:
+		output := e.OutputKey
+		if output == "" {
+			output = e.Name
+		}
+		return &types.Resource{Type: "data.terraform_remote_state", Identifier: e.ExportingStack, OutputKey: "outputs." + codegen.Name(output)}
+	}
+	return nil
+}
+
+// exportBlocks returns the data sources read by references to the exports.
+func (s Stack) exportBlocks() []codegen.HCLResource {
+	blocks := []codegen.HCLResource{}
+	seen := map[string]bool{}
+	for _, e := range s.Exports {
+		switch s.ExportReferences.Mode {
+		case types.ExportReferencesData:
+			blocks = append(blocks, exportData{e})
+		case types.ExportReferencesRemoteState:
+			if !seen[e.ExportingStack] {
+				seen[e.ExportingStack] = true
+				blocks = append(blocks, remoteState{stack: e.ExportingStack, refs: s.ExportReferences})
+			}
+		}
+	}
+	return blocks
+}
+
+type exportData struct {
+	Export
+}
+
+func (e exportData) WriteHCL(body *hclwrite.Body, stack codegen.Stack) {
+	b := body.AppendNewBlock("data", []string{"aws_cloudformation_export", codegen.Name(e.Name)}).Body()
+	b.SetAttributeValue("name", cty.StringVal(e.Name))
+}
+
+type remoteState struct {
+	stack string
+	refs  ExportReferences
+}
+
+func (r remoteState) WriteHCL(body *hclwrite.Body, stack codegen.Stack) {
+	b := body.AppendNewBlock("data", []string{"terraform_remote_state", codegen.Name(r.stack)}).Body()
+	b.SetAttributeValue("backend", cty.StringVal(r.refs.Backend))
+	config := map[string]string{}
+	for k, v := range r.refs.Config {
+		config[k] = strings.ReplaceAll(v, "{stack}", r.stack)
+	}
+	if len(config) > 0 {
+		b.SetAttributeValue("config", cty.ObjectVal(stringValues(config)))
+	}
+}
+
+func stringValues(m map[string]string) map[string]cty.Value {
+	vals := map[string]cty.Value{}
+	for k, v := range m {
+		vals[k] = cty.StringVal(v)
+	}
+	return vals
+}
+
+// GetImportedExports returns the exports of other stacks a stack imports by
+// name, with the output of the exporting stack holding each of them.
+func (aws *Client) GetImportedExports(ctx context.Context, names []string) ([]Export, error) {
+	if len(names) == 0 {
+		return nil, nil
+	}
+	exports, err := aws.ListExports(ctx)
+	if err != nil {
+		return nil, errors.Wrap(err, "unable to list exports")
+	}
+	byName := map[string]Export{}
+	for _, e := range exports {
+		byName[e.Name] = e
+	}
+
+	outputs := map[string]map[string]string{}
+	result := []Export{}
+	seen := map[string]bool{}
+	for _, name := range names {
+		e, has := byName[name]
+		if !has {
+			log.WithField("export", name).Warn("unable to find imported export")
+			continue
+		}
+		if seen[name] {
+			continue
+		}
+		seen[name] = true
+		keys, has := outputs[e.ExportingStack]
+		if !has {
+			if keys, err = aws.outputKeys(ctx, e.ExportingStack); err != nil {
+				return nil, err
+			}
+			outputs[e.ExportingStack] = keys
+		}
+		e.OutputKey = keys[e.Name]
+		e.ExportingStack = stackName(e.ExportingStack)
+		result = append(result, e)
+	}
+	return result, nil
+}
+
+// importValueNames returns the names of the exports a template imports with
+// Fn::ImportValue. Names built with Fn::Sub or Fn::Join are resolved from the
+// parameters and pseudo parameters of the stack, and skipped with a warning
+// when they can't be.
+func importValueNames(template string, stackName string, stackID string, parameters []Parameter) ([]string, error) {
+	if template == "" {
+		return nil, nil
+	}
+	t, err := cfn.Parse([]byte(template))
+	if err != nil {
+		return nil, err
+	}
+
+	values := map[string]string{"AWS::StackName": stackName}
+	// arn:partition:cloudformation:region:account:stack/name/id
+	if arn := strings.SplitN(stackID, ":", 6); len(arn) == 6 {
+		values["AWS::Partition"], values["AWS::Region"], values["AWS::AccountId"] = arn[1], arn[3], arn[4]
+	}
+	for _, p := range parameters {
+		if !p.NoEcho {
+			values[p.Key] = p.Value
+		}
+	}
+
+	roots := []interface{}{}
+	for _, id := range t.LogicalIDs() {
+		roots = append(roots, t.Resources[id].Properties)
+	}
+	for _, o := range t.Outputs {
+		roots = append(roots, o.Value)
+	}
+	names := []string{}
+	for _, root := range roots {
+		cfn.Walk(root, func(v interface{}) {
+			name, arg, ok := cfn.Intrinsic(v)
+			if !ok || name != "Fn::ImportValue" {
+				return
+			}
+			if exportName, ok := resolveName(arg, values); ok {
+				names = append(names, exportName)
+				return
+			}
+			log.WithField("import", arg).Warn("unable to resolve the name of an imported export")
+		})
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+// resolveName resolves a string built from the values of parameters.
+func resolveName(v interface{}, values map[string]string) (string, bool) {
+	if s, ok := v.(string); ok {
+		return s, true
+	}
+	if id, ok := cfn.Ref(v); ok {
+		value, has := values[id]
+		return value, has
+	}
+	if format, vars, ok := cfn.Sub(v); ok {
+		resolved := ""
+		for _, p := range cfn.SubParts(format) {
+			if p.Variable == "" {
+				resolved += p.Literal
+				continue
+			}
+			var value string
+			var has bool
+			if bound, isBound := vars[p.Variable]; isBound {
+				value, has = resolveName(bound, values)
+			} else {
+				value, has = values[p.Variable]
+			}
+			if !has {
+				return "", false
+			}
+			resolved += value
+		}
+		return resolved, true
+	}
+	if name, arg, ok := cfn.Intrinsic(v); ok && name == "Fn::Join" {
+		args, ok := arg.([]interface{})
+		if !ok || len(args) != 2 {
+			return "", false
+		}
+		delimiter, ok1 := args[0].(string)
+		elems, ok2 := args[1].([]interface{})
+		if !ok1 || !ok2 {
+			return "", false
+		}
+		parts := []string{}
+		for _, e := range elems {
+			s, ok := resolveName(e, values)
+			if !ok {
+				return "", false
+			}
+			parts = append(parts, s)
+		}
+		return strings.Join(parts, delimiter), true
+	}
+	return "", false
+}
+
+// ListExports returns every export of the account and region. The exporting
+// stack of each is its stack id.
+func (aws *Client) ListExports(ctx context.Context) ([]Export, error) {
+	input := &cloudformation.ListExportsInput{}
+	exports := []Export{}
+	for {
+		res, err := aws.cloudformation.ListExports(ctx, input)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, e := range res.Exports {
+			exports = append(exports, Export{
+				Name:           *e.Name,
+				Value:          *e.Value,
+				ExportingStack: *e.ExportingStackId,
+			})
+		}
+		if res.NextToken != nil {
+			input.NextToken = res.NextToken
+		} else {
+			break
+		}
+	}
+	return exports, nil
+}
+
+// outputKeys maps the export names of a stack to the keys of their outputs.
+func (aws *Client) outputKeys(ctx context.Context, stack string) (map[string]string, error) {
+	res, err := aws.cloudformation.DescribeStacks(ctx, &cloudformation.DescribeStacksInput{StackName: &stack})
+	if err != nil {
+		return nil, errors.Wrapf(err, "unable to describe stack %s", stack)
+	}
+	keys := map[string]string{}
+	for _, s := range res.Stacks {
+		for _, o := range s.Outputs {
+			if o.ExportName != nil && o.OutputKey != nil {
+				keys[*o.ExportName] = *o.OutputKey
+			}
+		}
+	}
+	return keys, nil
+}
@@ -0,0 +1,117 @@
+package aws
+
+import (
+	"context"
+	"encoding/json"
+	"reflect"
+	"sort"
+
+	"github.com/cr-norton/tfconvert/pkg/types"
+)
+
+// ResourceHandler converts a single CloudFormation resource type. Handlers are
+// added with Register, so resource types can be supported from outside this
+// package without editing GetStack.
+type ResourceHandler interface {
+	// ResourceType is the CloudFormation type handled, e.g. AWS::SQS::Queue.
+	ResourceType() string
+	// TerraformType is the terraform resource type generated, e.g. aws_sqs_queue.
+	TerraformType() string
+	// Template is the name of the template that renders the resource.
+	Template() string
+	// Fetch describes the physical resource behind a stack resource.
+	Fetch(ctx context.Context, client *Client, logicalID string, physicalID string) (StackResource, error)
+	// Decode unmarshals a resource previously fetched by the handler from json.
+	Decode(data []byte) (StackResource, error)
+}
+
+// StackResource is a resource fetched by a ResourceHandler.
+type StackResource interface {
+	// Resource returns the terraform address and import id of the resource. It
+	// is the single source of both the generated resource block and its import,
+	// and its type must match the TerraformType of the handler.
+	Resource() types.Resource
+}
+
+// keyed is implemented by resources other resources can reference, usually by arn.
+type keyed interface {
+	Key() string
+}
+
+// multiKeyed is implemented by resources also referenced by other values, such
+// as functions by the arns of their versions.
+type multiKeyed interface {
+	Keys() map[string]types.Resource
+}
+
+// parent is implemented by resources that generate more than one terraform
+// resource, such as roles with inline policies.
+type parent interface {
+	ChildResources() []types.Resource
+}
+
+// FetchFunc describes a physical resource.
+type FetchFunc func(ctx context.Context, client *Client, logicalID string, physicalID string) (StackResource, error)
+
+type handler struct {
+	resourceType  string
+	terraformType string
+	template      string
+	prototype     reflect.Type
+	fetch         FetchFunc
+}
+
+// NewHandler returns a ResourceHandler backed by a fetch function. The
+// prototype is a zero value of the type fetch returns, used to decode
+// snapshots.
+func NewHandler(resourceType, terraformType, template string, prototype StackResource, fetch FetchFunc) ResourceHandler {
+	return handler{
+		resourceType:  resourceType,
+		terraformType: terraformType,
+		template:      template,
+		prototype:     reflect.TypeOf(prototype),
+		fetch:         fetch,
+	}
+}
+
+func (h handler) ResourceType() string  { return h.resourceType }
+func (h handler) TerraformType() string { return h.terraformType }
+func (h handler) Template() string      { return h.template }
+
+func (h handler) Fetch(ctx context.Context, client *Client, logicalID string, physicalID string) (StackResource, error) {
+	return h.fetch(ctx, client, logicalID, physicalID)
+}
+
+func (h handler) Decode(data []byte) (StackResource, error) {
+	v := reflect.New(h.prototype)
+	if err := json.Unmarshal(data, v.Interface()); err != nil {
+		return nil, err
+	}
+	return v.Elem().Interface().(StackResource), nil
+}
+
+var handlers = map[string]ResourceHandler{}
+
+// Register adds a handler, replacing any handler already registered for the
+// same CloudFormation type.
+func Register(h ResourceHandler) {
+	handlers[h.ResourceType()] = h
+}
+
+// Handler returns the handler registered for a CloudFormation type.
+func Handler(resourceType string) (ResourceHandler, bool) {
+	h, has := handlers[resourceType]
+	return h, has
+}
+
+// Handlers returns every registered handler ordered by CloudFormation type.
+func Handlers() []ResourceHandler {
+	all := []ResourceHandler{}
+	for _, h := range handlers {
+		all = append(all, h)
+	}
+	sort.Slice(all, func(i, j int) bool {
+		return all[i].ResourceType() < all[j].ResourceType()
+	})
+	return all
+}
@@ -0,0 +1,149 @@
+package aws
+
+import (
+	"context"
+
+	"github.com/pkg/errors"
+)
+
+// ignored resource types are skipped without an unsupported resource warning,
+// such as the parts of an api converted along with it
+var ignored = map[string]bool{
+	"AWS::ApiGateway::Authorizer":    true,
+	"AWS::ApiGateway::Deployment":    true,
+	"AWS::ApiGateway::Method":        true,
+	"AWS::ApiGateway::Resource":      true,
+	"AWS::ApiGateway::Stage":         true,
+	"AWS::ApiGatewayV2::Integration": true,
+	"AWS::ApiGatewayV2::Route":       true,
+	"AWS::ApiGatewayV2::Stage":       true,
+}
+
+func init() {
+	Register(WithTemplate(NewHandler("AWS::ApiGateway::RestApi", "aws_api_gateway_rest_api", "apigateway.tmpl", RestApi{},
+		func(ctx context.Context, aws *Client, logicalID string, physicalID string) (StackResource, error) {
+			api, err := aws.GetRestApi(ctx, logicalID, physicalID)
+			if err != nil {
+				return nil, err
+			}
+			return *api, nil
+		}), restApiFromTemplate))
+	Register(NewHandler("AWS::ApiGatewayV2::Api", "aws_apigatewayv2_api", "apigateway.tmpl", ApiV2{},
+		func(ctx context.Context, aws *Client, logicalID string, physicalID string) (StackResource, error) {
+			api, err := aws.GetApiV2(ctx, logicalID, physicalID)
+			if err != nil {
+				return nil, err
+			}
+			return *api, nil
+		}))
+	Register(WithTemplate(NewHandler("AWS::DynamoDB::Table", "aws_dynamodb_table", "dynamodb.tmpl", DynamoTable{},
+		func(ctx context.Context, aws *Client, logicalID string, physicalID string) (StackResource, error) {
+			table, err := aws.GetDynamoTable(ctx, logicalID, physicalID)
+			if err != nil {
+				return nil, err
+			}
+			return *table, nil
+		}), dynamoTableFromTemplate))
+	Register(WithTemplate(NewHandler("AWS::IAM::Role", "aws_iam_role", "iam.tmpl", Role{},
+		func(ctx context.Context, aws *Client, logicalID string, physicalID string) (StackResource, error) {
+			role, err := aws.GetRole(ctx, logicalID, physicalID)
+			if err != nil {
+				return nil, errors.Wrap(err, "unable to get IAM role")
+			}
+			return *role, nil
+		}), roleFromTemplate))
+	Register(WithTemplate(NewHandler("AWS::KinesisFirehose::DeliveryStream", "aws_kinesis_firehose_delivery_stream", "firehose.tmpl", FirehoseDeliveryStream{},
+		func(ctx context.Context, aws *Client, logicalID string, physicalID string) (StackResource, error) {
+			stream, err := aws.GetFirehoseDeliveryStream(ctx, logicalID, physicalID)
+			if err != nil {
+				return nil, err
+			}
+			return *stream, nil
+		}), firehoseDeliveryStreamFromTemplate))
+	Register(WithTemplate(NewHandler("AWS::Lambda::Function", "aws_lambda_function", "lambda.tmpl", LambdaFunctionConfiguration{},
+		func(ctx context.Context, aws *Client, logicalID string, physicalID string) (StackResource, error) {
+			function, err := aws.GetLambdaFunction(ctx, logicalID, physicalID)
+			if err != nil {
+				return nil, err
+			}
+			return *function, nil
+		}), lambdaFunctionFromTemplate))
+	Register(WithTemplate(NewHandler("AWS::Lambda::EventSourceMapping", "aws_lambda_event_source_mapping", "lambda.tmpl", LambdaEventSource{},
+		func(ctx context.Context, aws *Client, logicalID string, physicalID string) (StackResource, error) {
+			event, err := aws.GetLambdaEventSource(ctx, logicalID, physicalID)
+			if err != nil {
+				return nil, err
+			}
+			return *event, nil
+		}), lambdaEventSourceFromTemplate))
+	Register(WithTemplate(NewHandler("AWS::Lambda::Alias", "aws_lambda_alias", "lambda.tmpl", LambdaAlias{},
+		func(ctx context.Context, aws *Client, logicalID string, physicalID string) (StackResource, error) {
+			alias, err := aws.GetLambdaAlias(ctx, logicalID, physicalID)
+			if err != nil {
+				return nil, err
+			}
+			return *alias, nil
+		}), lambdaAliasFromTemplate))
+	Register(WithTemplate(NewHandler("AWS::Lambda::LayerVersion", "aws_lambda_layer_version", "lambda.tmpl", LambdaLayerVersion{},
+		func(ctx context.Context, aws *Client, logicalID string, physicalID string) (StackResource, error) {
+			layer, err := aws.GetLambdaLayerVersion(ctx, logicalID, physicalID)
+			if err != nil {
+				return nil, err
+			}
+			return *layer, nil
+		}), lambdaLayerVersionFromTemplate))
+	Register(WithTemplate(NewHandler("AWS::Lambda::Permission", "aws_lambda_permission", "lambda.tmpl", LambdaPermission{},
+		func(ctx context.Context, aws *Client, logicalID string, physicalID string) (StackResource, error) {
+			// the statements of permissions are read from the policies of
+			// their functions once the stack is fetched
+			return lambdaPermission(logicalID, physicalID), nil
+		}), lambdaPermissionFromTemplate))
+	Register(WithTemplate(NewHandler("AWS::Logs::LogGroup", "aws_cloudwatch_log_group", "lambda.tmpl", LogGroup{},
+		func(ctx context.Context, aws *Client, logicalID string, physicalID string) (StackResource, error) {
+			logs, err := aws.GetLogGroup(ctx, logicalID, physicalID)
+			if err != nil {
+				return nil, err
+			}
+			return *logs, nil
+		}), logGroupFromTemplate))
+	Register(NewHandler("AWS::S3::Bucket", "aws_s3_bucket", "s3.tmpl", Bucket{},
+		func(ctx context.Context, aws *Client, logicalID string, physicalID string) (StackResource, error) {
+			bucket, err := aws.GetBucket(ctx, logicalID, physicalID)
+			if err != nil {
+				return nil, err
+			}
+			return *bucket, nil
+		}))
+	Register(NewHandler("AWS::S3::BucketPolicy", "aws_s3_bucket_policy", "s3.tmpl", BucketPolicy{},
+		func(ctx context.Context, aws *Client, logicalID string, physicalID string) (StackResource, error) {
+			policy, err := aws.GetBucketPolicy(ctx, logicalID, physicalID)
+			if err != nil {
+				return nil, errors.Wrap(err, "unable to get bucket policy")
+			}
+			return *policy, nil
+		}))
+	Register(WithTemplate(NewHandler("AWS::SQS::Queue", "aws_sqs_queue", "sqs.tmpl", Queue{},
+		func(ctx context.Context, aws *Client, logicalID string, physicalID string) (StackResource, error) {
+			queue, err := aws.GetQueue(ctx, logicalID, physicalID)
+			if err != nil {
+				return nil, err
+			}
+			return *queue, nil
+		}), queueFromTemplate))
+	Register(WithTemplate(NewHandler("AWS::SNS::Topic", "aws_sns_topic", "sns.tmpl", Topic{},
+		func(ctx context.Context, aws *Client, logicalID string, physicalID string) (StackResource, error) {
+			topic, err := aws.GetTopic(ctx, logicalID, physicalID)
+			if err != nil {
+				return nil, err
+			}
+			return *topic, nil
+		}), topicFromTemplate))
+	Register(WithTemplate(NewHandler("AWS::SNS::Subscription", "aws_sns_topic_subscription", "sns.tmpl", TopicSubscription{},
+		func(ctx context.Context, aws *Client, logicalID string, physicalID string) (StackResource, error) {
+			subscription, err := aws.GetTopicSubscription(ctx, logicalID, physicalID)
+			if err != nil {
+				return nil, err
+			}
+			return *subscription, nil
+		}), topicSubscriptionFromTemplate))
+}
@@ -0,0 +1,352 @@
+package aws
+
+import (
+	"testing"
+
+	apigatewayTypes "github.com/aws/aws-sdk-go-v2/service/apigateway/types"
+	apigatewayv2Types "github.com/aws/aws-sdk-go-v2/service/apigatewayv2/types"
+	logs "github.com/aws/aws-sdk-go-v2/service/cloudwatchlogs/types"
+	dynamodb "github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	firehose "github.com/aws/aws-sdk-go-v2/service/firehose/types"
+	iam "github.com/aws/aws-sdk-go-v2/service/iam/types"
+	lambda "github.com/aws/aws-sdk-go-v2/service/lambda/types"
+	s3Types "github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/cr-norton/tfconvert/pkg/codegen"
+)
+
+const (
+	testFunctionArn = "arn:aws:lambda:us-east-1:123456789012:function:orders"
+	testQueueArn    = "arn:aws:sqs:us-east-1:123456789012:orders"
+	testTopicArn    = "arn:aws:sns:us-east-1:123456789012:orders"
+)
+
+// TestHandlers converts a populated resource of every handler, checking the
+// resource and its children are each written once and imported by the id
+// format terraform expects.
+func TestHandlers(t *testing.T) {
+	s := func(v string) *string { return &v }
+	i32 := func(v int32) *int32 { return &v }
+
+	tests := map[string]struct {
+		resource StackResource
+		// imports are the import ids of the resource and its children, keyed
+		// by type and identifier
+		imports map[string]string
+	}{
+		"AWS::ApiGateway::RestApi": {
+			resource: RestApi{
+				LogicalID: "Api",
+				RestApi:   apigatewayTypes.RestApi{Id: s("api1"), Name: s("orders")},
+				Resources: []apigatewayTypes.Resource{
+					{Id: s("root"), Path: s("/"), ResourceMethods: map[string]apigatewayTypes.Method{
+						"GET": {
+							HttpMethod:        s("GET"),
+							AuthorizationType: s("NONE"),
+							MethodResponses:   map[string]apigatewayTypes.MethodResponse{"200": {StatusCode: s("200")}},
+							MethodIntegration: &apigatewayTypes.Integration{
+								Type:                 apigatewayTypes.IntegrationTypeAwsProxy,
+								HttpMethod:           s("POST"),
+								Uri:                  s("arn:aws:apigateway:us-east-1:lambda:path/2015-03-31/functions/" + testFunctionArn + "/invocations"),
+								IntegrationResponses: map[string]apigatewayTypes.IntegrationResponse{"200": {StatusCode: s("200")}},
+							},
+						},
+					}},
+					{Id: s("res1"), ParentId: s("root"), PathPart: s("orders"), Path: s("/orders"), ResourceMethods: map[string]apigatewayTypes.Method{
+						"POST": {HttpMethod: s("POST"), AuthorizationType: s("CUSTOM"), AuthorizerId: s("auth1")},
+					}},
+				},
+				Authorizers: []apigatewayTypes.Authorizer{{Id: s("auth1"), Name: s("tokens"), Type: apigatewayTypes.AuthorizerTypeToken}},
+				Deployments: []apigatewayTypes.Deployment{{Id: s("dep1")}},
+				Stages:      []apigatewayTypes.Stage{{StageName: s("prod"), DeploymentId: s("dep1")}},
+			},
+			imports: map[string]string{
+				"aws_api_gateway_rest_api.Api":                     "api1",
+				"aws_api_gateway_method.Api_GET":                   "api1/root/GET",
+				"aws_api_gateway_method_response.Api_GET_200":      "api1/root/GET/200",
+				"aws_api_gateway_integration.Api_GET":              "api1/root/GET",
+				"aws_api_gateway_integration_response.Api_GET_200": "api1/root/GET/200",
+				"aws_api_gateway_resource.Api_orders":              "api1/res1",
+				"aws_api_gateway_method.Api_orders_POST":           "api1/res1/POST",
+				"aws_api_gateway_authorizer.Api_tokens":            "api1/auth1",
+				"aws_api_gateway_deployment.Api_prod":              "api1/dep1",
+				"aws_api_gateway_stage.Api_prod":                   "api1/prod",
+			},
+		},
+		"AWS::ApiGatewayV2::Api": {
+			resource: ApiV2{
+				LogicalID: "HttpApi",
+				Api:       apigatewayv2Types.Api{ApiId: s("http1"), Name: s("orders"), ProtocolType: apigatewayv2Types.ProtocolTypeHttp},
+				Integrations: []apigatewayv2Types.Integration{{
+					IntegrationId:        s("int1"),
+					IntegrationType:      apigatewayv2Types.IntegrationTypeAwsProxy,
+					IntegrationUri:       s(testFunctionArn),
+					PayloadFormatVersion: s("2.0"),
+				}},
+				Routes: []apigatewayv2Types.Route{{RouteId: s("route1"), RouteKey: s("GET /orders"), Target: s("integrations/int1")}},
+				Stages: []apigatewayv2Types.Stage{{StageName: s("$default"), AutoDeploy: true}},
+			},
+			imports: map[string]string{
+				"aws_apigatewayv2_api.HttpApi":                    "http1",
+				"aws_apigatewayv2_integration.HttpApi_GET_orders": "http1/int1",
+				"aws_apigatewayv2_route.HttpApi_GET_orders":       "http1/route1",
+				"aws_apigatewayv2_stage.HttpApi_default":          "http1/$default",
+			},
+		},
+		"AWS::DynamoDB::Table": {
+			resource: DynamoTable{
+				LogicalID: "Table",
+				TableDescription: dynamodb.TableDescription{
+					TableName:            s("orders"),
+					TableArn:             s("arn:aws:dynamodb:us-east-1:123456789012:table/orders"),
+					KeySchema:            []dynamodb.KeySchemaElement{{AttributeName: s("id"), KeyType: dynamodb.KeyTypeHash}},
+					AttributeDefinitions: []dynamodb.AttributeDefinition{{AttributeName: s("id"), AttributeType: dynamodb.ScalarAttributeTypeS}},
+				},
+			},
+			imports: map[string]string{
+				"aws_dynamodb_table.Table": "orders",
+			},
+		},
+		"AWS::IAM::Role": {
+			resource: Role{
+				LogicalID:        "Role",
+				PolicyDocuments:  map[string]string{"Logs": "%7B%22Version%22%3A%222012-10-17%22%7D"},
+				AttachedPolicies: []iam.Policy{{PolicyName: s("ReadOnlyAccess"), Arn: s("arn:aws:iam::aws:policy/ReadOnlyAccess")}},
+				Role: iam.Role{
+					RoleName:                 s("orders-role"),
+					Arn:                      s("arn:aws:iam::123456789012:role/orders-role"),
+					AssumeRolePolicyDocument: s("%7B%22Version%22%3A%222012-10-17%22%7D"),
+				},
+			},
+			imports: map[string]string{
+				"aws_iam_role.Role":                                  "orders-role",
+				"aws_iam_role_policy.Role_Logs":                      "orders-role:Logs",
+				"aws_iam_role_policy_attachment.Role_ReadOnlyAccess": "orders-role/arn:aws:iam::aws:policy/ReadOnlyAccess",
+			},
+		},
+		"AWS::KinesisFirehose::DeliveryStream": {
+			resource: FirehoseDeliveryStream{
+				LogicalID: "Stream",
+				DeliveryStreamDescription: firehose.DeliveryStreamDescription{
+					DeliveryStreamName: s("events"),
+					DeliveryStreamARN:  s("arn:aws:firehose:us-east-1:123456789012:deliverystream/events"),
+				},
+			},
+			imports: map[string]string{
+				"aws_kinesis_firehose_delivery_stream.Stream": "arn:aws:firehose:us-east-1:123456789012:deliverystream/events",
+			},
+		},
+		"AWS::Lambda::Function": {
+			resource: LambdaFunctionConfiguration{
+				LogicalID: "Function",
+				FunctionConfiguration: lambda.FunctionConfiguration{
+					FunctionName: s("orders"),
+					FunctionArn:  s(testFunctionArn),
+					Handler:      s("index.handler"),
+					Runtime:      lambda.RuntimePython38,
+				},
+				Versions: []LambdaVersion{{
+					LogicalID:              "Version",
+					FunctionArn:            testFunctionArn + ":3",
+					Version:                "3",
+					ProvisionedConcurrency: i32(2),
+				}},
+				LatestVersion: "3",
+			},
+			imports: map[string]string{
+				"aws_lambda_function.Function":                      "orders",
+				"aws_lambda_provisioned_concurrency_config.Version": "orders:3",
+			},
+		},
+		"AWS::Lambda::EventSourceMapping": {
+			resource: LambdaEventSource{
+				LogicalID: "EventSource",
+				EventSourceMappingConfiguration: lambda.EventSourceMappingConfiguration{
+					UUID:           s("uuid1"),
+					EventSourceArn: s(testQueueArn),
+					FunctionArn:    s(testFunctionArn),
+				},
+			},
+			imports: map[string]string{
+				"aws_lambda_event_source_mapping.EventSource": "uuid1",
+			},
+		},
+		"AWS::Lambda::Alias": {
+			resource: LambdaAlias{
+				LogicalID: "Alias",
+				AliasConfiguration: lambda.AliasConfiguration{
+					AliasArn:        s(testFunctionArn + ":live"),
+					Name:            s("live"),
+					FunctionVersion: s("3"),
+				},
+				FunctionArn:            testFunctionArn,
+				ProvisionedConcurrency: i32(1),
+			},
+			imports: map[string]string{
+				"aws_lambda_alias.Alias":                          "orders/live",
+				"aws_lambda_provisioned_concurrency_config.Alias": "orders:live",
+			},
+		},
+		"AWS::Lambda::LayerVersion": {
+			resource: LambdaLayerVersion{
+				LogicalID:       "Layer",
+				LayerArn:        "arn:aws:lambda:us-east-1:123456789012:layer:deps",
+				LayerVersionArn: "arn:aws:lambda:us-east-1:123456789012:layer:deps:2",
+			},
+			imports: map[string]string{
+				"aws_lambda_layer_version.Layer": "arn:aws:lambda:us-east-1:123456789012:layer:deps:2",
+			},
+		},
+		"AWS::Lambda::Permission": {
+			resource: LambdaPermission{
+				LogicalID:   "Permission",
+				StatementID: "sid1",
+				FunctionArn: testFunctionArn,
+				Action:      "lambda:InvokeFunction",
+				Principal:   "sns.amazonaws.com",
+				SourceArn:   s(testTopicArn),
+			},
+			imports: map[string]string{
+				"aws_lambda_permission.Permission": "orders/sid1",
+			},
+		},
+		"AWS::Logs::LogGroup": {
+			resource: LogGroup{
+				LogicalID: "Logs",
+				LogGroup: logs.LogGroup{
+					LogGroupName:    s("/aws/lambda/orders"),
+					Arn:             s("arn:aws:logs:us-east-1:123456789012:log-group:/aws/lambda/orders:*"),
+					RetentionInDays: i32(14),
+				},
+			},
+			imports: map[string]string{
+				"aws_cloudwatch_log_group.Logs": "/aws/lambda/orders",
+			},
+		},
+		"AWS::S3::Bucket": {
+			resource: Bucket{
+				LogicalID:        "Bucket",
+				Name:             "orders-bucket",
+				VersioningStatus: s3Types.BucketVersioningStatusEnabled,
+				Encryption: []s3Types.ServerSideEncryptionRule{{
+					ApplyServerSideEncryptionByDefault: &s3Types.ServerSideEncryptionByDefault{SSEAlgorithm: s3Types.ServerSideEncryptionAes256},
+				}},
+				LifecycleRules: []LifecycleRule{{
+					LifecycleRule: s3Types.LifecycleRule{ID: s("expire"), Status: s3Types.ExpirationStatusEnabled},
+					FilterPrefix:  s("tmp/"),
+				}},
+				CORSRules: []s3Types.CORSRule{{AllowedMethods: []string{"GET"}, AllowedOrigins: []string{"*"}}},
+				Notifications: &BucketNotifications{
+					QueueConfigurations: []s3Types.QueueConfiguration{{
+						QueueArn: s(testQueueArn),
+						Events:   []s3Types.Event{"s3:ObjectCreated:*"},
+					}},
+				},
+				PublicAccessBlock: &s3Types.PublicAccessBlockConfiguration{BlockPublicAcls: true},
+				Logging:           &s3Types.LoggingEnabled{TargetBucket: s("logs"), TargetPrefix: s("orders/")},
+			},
+			imports: map[string]string{
+				"aws_s3_bucket.Bucket":                                      "orders-bucket",
+				"aws_s3_bucket_versioning.Bucket":                           "orders-bucket",
+				"aws_s3_bucket_server_side_encryption_configuration.Bucket": "orders-bucket",
+				"aws_s3_bucket_lifecycle_configuration.Bucket":              "orders-bucket",
+				"aws_s3_bucket_cors_configuration.Bucket":                   "orders-bucket",
+				"aws_s3_bucket_notification.Bucket":                         "orders-bucket",
+				"aws_s3_bucket_public_access_block.Bucket":                  "orders-bucket",
+				"aws_s3_bucket_logging.Bucket":                              "orders-bucket",
+			},
+		},
+		"AWS::S3::BucketPolicy": {
+			resource: BucketPolicy{
+				LogicalID: "BucketPolicy",
+				Bucket:    "orders-bucket",
+				Policy:    `{"Version":"2012-10-17","Statement":[]}`,
+			},
+			imports: map[string]string{
+				"aws_s3_bucket_policy.BucketPolicy": "orders-bucket",
+			},
+		},
+		"AWS::SQS::Queue": {
+			resource: Queue{
+				LogicalID:  "Queue",
+				URL:        "https://sqs.us-east-1.amazonaws.com/123456789012/orders",
+				Attributes: map[string]string{"QueueArn": testQueueArn},
+			},
+			imports: map[string]string{
+				"aws_sqs_queue.Queue": "https://sqs.us-east-1.amazonaws.com/123456789012/orders",
+			},
+		},
+		"AWS::SNS::Topic": {
+			resource: Topic{
+				LogicalID:  "Topic",
+				Attributes: map[string]string{"TopicArn": testTopicArn},
+			},
+			imports: map[string]string{
+				"aws_sns_topic.Topic": testTopicArn,
+			},
+		},
+		"AWS::SNS::Subscription": {
+			resource: TopicSubscription{
+				LogicalID: "Subscription",
+				Attributes: map[string]string{
+					"SubscriptionArn": testTopicArn + ":sub1",
+					"TopicArn":        testTopicArn,
+					"Protocol":        "sqs",
+					"Endpoint":        testQueueArn,
+				},
+			},
+			imports: map[string]string{
+				"aws_sns_topic_subscription.Subscription": testTopicArn + ":sub1",
+			},
+		},
+	}
+
+	for _, h := range Handlers() {
+		h := h
+		t.Run(h.ResourceType(), func(t *testing.T) {
+			test, has := tests[h.ResourceType()]
+			if !has {
+				t.Fatalf("no populated %s to convert", h.ResourceType())
+			}
+			if res := test.resource.Resource(); res.Type != h.TerraformType() {
+				t.Fatalf("Resource().Type = %s, want %s", res.Type, h.TerraformType())
+			}
+
+			stackres := &StackResources{ByType: map[string][]StackResource{}}
+			if err := stackres.add(h, test.resource); err != nil {
+				t.Fatal(err)
+			}
+			stack := &Stack{
+				Name:           "shop",
+				ServiceName:    "shop",
+				Index:          index(stackres),
+				StackResources: stackres,
+			}
+			resources := stack.Resources()
+			if err := codegen.CheckAddresses(codegen.GenerateHCL(stack), resources); err != nil {
+				t.Fatal(err)
+			}
+
+			imports := map[string]string{}
+			for _, r := range resources {
+				imports[r.Type+"."+r.Identifier] = r.ImportKey
+			}
+			for address, want := range test.imports {
+				if got, has := imports[address]; !has {
+					t.Errorf("%s is missing", address)
+				} else if got != want {
+					t.Errorf("%s is imported by %s, want %s", address, got, want)
+				}
+			}
+			for address := range imports {
+				if _, has := test.imports[address]; !has {
+					t.Errorf("%s is unexpected", address)
+				}
+			}
+
+			unstated := codegen.Unstated(resources, map[string][]codegen.StateResource{"": stack.StateResources()})
+			for _, r := range unstated {
+				t.Errorf("%s.%s is missing from state", r.Type, r.Identifier)
+			}
+		})
+	}
+}
@@ -0,0 +1,402 @@
+package aws
+
+import (
+	"fmt"
+	"net/url"
+	"sort"
+
+	dynamodb "github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	lambdaTypes "github.com/aws/aws-sdk-go-v2/service/lambda/types"
+	"github.com/cr-norton/tfconvert/pkg/codegen"
+	"github.com/hashicorp/hcl/v2/hclwrite"
+	"github.com/zclconf/go-cty/cty"
+)
+
+// HCLResources groups the resources of the stack by the template of their
+// handler. When functions are grouped, each function is written first to a
+// file of its own, followed by the resources SAM generates for it.
+func (s Stack) HCLResources() map[string][]codegen.HCLResource {
+	groups := map[string]string{}
+	if s.GroupFunctions {
+		groups = s.functionGroups()
+	}
+
+	files := map[string][]codegen.HCLResource{}
+	for _, h := range Handlers() {
+		for _, r := range s.Get(h.ResourceType()) {
+			w, ok := r.(codegen.HCLResource)
+			if !ok {
+				continue
+			}
+			id := r.Resource().Identifier
+			f, grouped := groups[id]
+			switch {
+			case !grouped:
+				files[h.Template()] = append(files[h.Template()], w)
+			case f == id:
+				files[functionFile(f)] = append([]codegen.HCLResource{w}, files[functionFile(f)]...)
+			default:
+				files[functionFile(f)] = append(files[functionFile(f)], w)
+			}
+		}
+	}
+	if blocks := s.exportBlocks(); len(blocks) > 0 {
+		files["exports.tmpl"] = blocks
+	}
+	if blocks := s.pseudoParameterBlocks(); len(blocks) > 0 {
+		files["data.tmpl"] = blocks
+	}
+	for name, blocks := range s.interfaceBlocks() {
+		files[name] = blocks
+	}
+	return files
+}
+
+func (d DynamoTable) WriteHCL(body *hclwrite.Body, stack codegen.Stack) {
+	b := codegen.ResourceBlock(body, d.Resource())
+	codegen.SetInterpolation(b, "name", stack, d.TableName)
+	if d.BillingModeSummary != nil && d.BillingModeSummary.BillingMode == dynamodb.BillingModePayPerRequest {
+		b.SetAttributeValue("billing_mode", cty.StringVal(string(d.BillingModeSummary.BillingMode)))
+	} else if d.ProvisionedThroughput != nil {
+		setInt64Property(b, "read_capacity", stack, d.LogicalID+".ProvisionedThroughput.ReadCapacityUnits", d.ProvisionedThroughput.ReadCapacityUnits)
+		setInt64Property(b, "write_capacity", stack, d.LogicalID+".ProvisionedThroughput.WriteCapacityUnits", d.ProvisionedThroughput.WriteCapacityUnits)
+	}
+	setString(b, "hash_key", keySchemaElement(d.KeySchema, dynamodb.KeyTypeHash))
+	setString(b, "range_key", keySchemaElement(d.KeySchema, dynamodb.KeyTypeRange))
+
+	for _, attr := range d.AttributeDefinitions {
+		b.AppendNewline()
+		ab := b.AppendNewBlock("attribute", nil).Body()
+		setString(ab, "name", attr.AttributeName)
+		ab.SetAttributeValue("type", cty.StringVal(string(attr.AttributeType)))
+	}
+
+	for i, gsi := range d.GlobalSecondaryIndexes {
+		b.AppendNewline()
+		gb := b.AppendNewBlock("global_secondary_index", nil).Body()
+		setString(gb, "name", gsi.IndexName)
+		setString(gb, "hash_key", keySchemaElement(gsi.KeySchema, dynamodb.KeyTypeHash))
+		setString(gb, "range_key", keySchemaElement(gsi.KeySchema, dynamodb.KeyTypeRange))
+		if gsi.ProvisionedThroughput != nil && b.GetAttribute("billing_mode") == nil {
+			throughput := fmt.Sprintf("%s.GlobalSecondaryIndexes.%d.ProvisionedThroughput", d.LogicalID, i)
+			setInt64Property(gb, "write_capacity", stack, throughput+".WriteCapacityUnits", gsi.ProvisionedThroughput.WriteCapacityUnits)
+			setInt64Property(gb, "read_capacity", stack, throughput+".ReadCapacityUnits", gsi.ProvisionedThroughput.ReadCapacityUnits)
+		}
+		if gsi.Projection != nil {
+			gb.SetAttributeValue("projection_type", cty.StringVal(string(gsi.Projection.ProjectionType)))
+			if gsi.Projection.ProjectionType == dynamodb.ProjectionTypeInclude {
+				gb.SetAttributeValue("non_key_attributes", codegen.StringList(gsi.Projection.NonKeyAttributes))
+			}
+		}
+	}
+
+	b.AppendNewline()
+	codegen.SetTags(b, stack)
+}
+
+func (r Role) WriteHCL(body *hclwrite.Body, stack codegen.Stack) {
+	role := r.Resource()
+	b := codegen.ResourceBlock(body, role)
+	codegen.SetInterpolation(b, "name", stack, r.RoleName)
+	if r.AssumeRolePolicyDocument != nil {
+		b.SetAttributeRaw("assume_role_policy", codegen.JSONEncodeReferences(stack, decodePolicyDocument(*r.AssumeRolePolicyDocument)))
+	}
+	b.AppendNewline()
+	codegen.SetTags(b, stack)
+
+	for _, policy := range r.inlinePolicies() {
+		body.AppendNewline()
+		pb := codegen.ResourceBlock(body, policy.Resource)
+		pb.SetAttributeValue("name", cty.StringVal(policy.Name))
+		pb.SetAttributeTraversal("role", codegen.Traversal(role.Type, codegen.Name(role.Identifier), "id"))
+		pb.SetAttributeRaw("policy", codegen.JSONEncodeReferences(stack, decodePolicyDocument(r.PolicyDocuments[policy.Name])))
+	}
+
+	for _, a := range r.policyAttachments() {
+		body.AppendNewline()
+		ab := codegen.ResourceBlock(body, a.Resource)
+		ab.SetAttributeTraversal("role", codegen.Traversal(role.Type, codegen.Name(role.Identifier), "id"))
+		codegen.SetReference(ab, "policy_arn", stack, a.PolicyArn)
+	}
+}
+
+func (f FirehoseDeliveryStream) WriteHCL(body *hclwrite.Body, stack codegen.Stack) {
+	b := codegen.ResourceBlock(body, f.Resource())
+	codegen.SetInterpolation(b, "name", stack, f.DeliveryStreamName)
+	b.SetAttributeValue("destination", cty.StringVal("extended_s3"))
+
+	for _, dest := range f.Destinations {
+		s3 := dest.ExtendedS3DestinationDescription
+		if s3 == nil {
+			continue
+		}
+		b.AppendNewline()
+		sb := b.AppendNewBlock("extended_s3_configuration", nil).Body()
+		if s3.RoleARN != nil {
+			codegen.SetReference(sb, "role_arn", stack, *s3.RoleARN)
+		}
+		if s3.BucketARN != nil {
+			codegen.SetReference(sb, "bucket_arn", stack, *s3.BucketARN)
+		}
+		setString(sb, "prefix", s3.Prefix)
+		setString(sb, "error_output_prefix", s3.ErrorOutputPrefix)
+		if s3.BufferingHints != nil {
+			hints := f.LogicalID + ".ExtendedS3DestinationConfiguration.BufferingHints"
+			setInt32Property(sb, "buffering_size", stack, hints+".SizeInMBs", s3.BufferingHints.SizeInMBs)
+			setInt32Property(sb, "buffering_interval", stack, hints+".IntervalInSeconds", s3.BufferingHints.IntervalInSeconds)
+		}
+		if s3.CompressionFormat != "" {
+			sb.SetAttributeValue("compression_format", cty.StringVal(string(s3.CompressionFormat)))
+		}
+	}
+
+	b.AppendNewline()
+	codegen.SetTags(b, stack)
+}
+
+func (l LambdaFunctionConfiguration) WriteHCL(body *hclwrite.Body, stack codegen.Stack) {
+	function := l.Resource()
+	b := codegen.ResourceBlock(body, function)
+	if l.PackageType == lambdaTypes.PackageTypeImage {
+		b.SetAttributeValue("package_type", cty.StringVal(string(l.PackageType)))
+		setString(b, "image_uri", l.ImageUri)
+	} else {
+		b.SetAttributeValue("filename", cty.StringVal("lambda_function_payload.zip"))
+	}
+	codegen.SetInterpolation(b, "function_name", stack, l.FunctionName)
+	setString(b, "description", l.Description)
+	if l.Role != nil {
+		codegen.SetReference(b, "role", stack, *l.Role)
+	}
+	setString(b, "handler", l.Handler)
+	if l.Runtime != "" {
+		b.SetAttributeValue("runtime", cty.StringVal(string(l.Runtime)))
+	}
+	if len(l.Architectures) > 0 {
+		architectures := []string{}
+		for _, a := range l.Architectures {
+			architectures = append(architectures, string(a))
+		}
+		b.SetAttributeValue("architectures", codegen.StringList(architectures))
+	}
+	setInt32Property(b, "memory_size", stack, l.LogicalID+".MemorySize", l.MemorySize)
+	setInt32Property(b, "timeout", stack, l.LogicalID+".Timeout", l.Timeout)
+	setInt32Property(b, "reserved_concurrent_executions", stack, l.LogicalID+".ReservedConcurrentExecutions", l.ReservedConcurrentExecutions)
+	if l.KMSKeyArn != nil {
+		codegen.SetReference(b, "kms_key_arn", stack, *l.KMSKeyArn)
+	}
+	if len(l.Versions) > 0 {
+		b.SetAttributeValue("publish", cty.True)
+	}
+	if len(l.Layers) > 0 {
+		// layers of the stack are referenced, others written as their arn
+		layers := []hclwrite.Tokens{}
+		for _, layer := range l.Layers {
+			layers = append(layers, codegen.Reference(stack, str(layer.Arn)))
+		}
+		b.SetAttributeRaw("layers", codegen.List(layers...))
+	}
+
+	if l.Environment != nil && len(l.Environment.Variables) > 0 {
+		b.AppendNewline()
+		eb := b.AppendNewBlock("environment", nil).Body()
+		eb.SetAttributeRaw("variables", referenceMap(stack, l.Environment.Variables))
+	}
+
+	if c := l.ImageConfigResponse; c != nil && c.ImageConfig != nil {
+		b.AppendNewline()
+		ib := b.AppendNewBlock("image_config", nil).Body()
+		if len(c.ImageConfig.Command) > 0 {
+			ib.SetAttributeValue("command", codegen.StringList(c.ImageConfig.Command))
+		}
+		if len(c.ImageConfig.EntryPoint) > 0 {
+			ib.SetAttributeValue("entry_point", codegen.StringList(c.ImageConfig.EntryPoint))
+		}
+		setString(ib, "working_directory", c.ImageConfig.WorkingDirectory)
+	}
+
+	if s := l.EphemeralStorage; s != nil {
+		b.AppendNewline()
+		sb := b.AppendNewBlock("ephemeral_storage", nil).Body()
+		setInt32Property(sb, "size", stack, l.LogicalID+".EphemeralStorage.Size", s.Size)
+	}
+
+	if c := l.VpcConfig; c != nil && len(c.SubnetIds) > 0 {
+		// subnets and security groups of the stack are referenced
+		subnets := []hclwrite.Tokens{}
+		for _, id := range c.SubnetIds {
+			subnets = append(subnets, codegen.Reference(stack, id))
+		}
+		groups := []hclwrite.Tokens{}
+		for _, id := range c.SecurityGroupIds {
+			groups = append(groups, codegen.Reference(stack, id))
+		}
+		b.AppendNewline()
+		vb := b.AppendNewBlock("vpc_config", nil).Body()
+		vb.SetAttributeRaw("subnet_ids", codegen.List(subnets...))
+		vb.SetAttributeRaw("security_group_ids", codegen.List(groups...))
+	}
+
+	if c := l.DeadLetterConfig; c != nil && c.TargetArn != nil {
+		b.AppendNewline()
+		db := b.AppendNewBlock("dead_letter_config", nil).Body()
+		codegen.SetReference(db, "target_arn", stack, *c.TargetArn)
+	}
+
+	if c := l.TracingConfig; c != nil && c.Mode != "" {
+		b.AppendNewline()
+		tb := b.AppendNewBlock("tracing_config", nil).Body()
+		tb.SetAttributeValue("mode", cty.StringVal(string(c.Mode)))
+	}
+
+	for _, c := range l.FileSystemConfigs {
+		b.AppendNewline()
+		fb := b.AppendNewBlock("file_system_config", nil).Body()
+		if c.Arn != nil {
+			codegen.SetReference(fb, "arn", stack, *c.Arn)
+		}
+		setString(fb, "local_mount_path", c.LocalMountPath)
+	}
+
+	b.AppendNewline()
+	codegen.SetTags(b, stack)
+
+	for _, v := range l.Versions {
+		if v.ProvisionedConcurrency == nil {
+			continue
+		}
+		body.AppendNewline()
+		pb := codegen.ResourceBlock(body, v.provisionedConcurrency())
+		pb.SetAttributeTraversal("function_name", codegen.Traversal(function.Type, codegen.Name(function.Identifier), "function_name"))
+		pb.SetAttributeRaw("qualifier", versionReference(stack, *l.FunctionArn, v.Version))
+		setInt32Property(pb, "provisioned_concurrent_executions", stack, v.LogicalID+".ProvisionedConcurrencyConfig.ProvisionedConcurrentExecutions", v.ProvisionedConcurrency)
+	}
+}
+
+func (l LambdaEventSource) WriteHCL(body *hclwrite.Body, stack codegen.Stack) {
+	b := codegen.ResourceBlock(body, l.Resource())
+	if l.EventSourceArn != nil {
+		codegen.SetReference(b, "event_source_arn", stack, *l.EventSourceArn)
+	}
+	if l.FunctionArn != nil {
+		codegen.SetReference(b, "function_name", stack, *l.FunctionArn)
+	}
+}
+
+func (l LogGroup) WriteHCL(body *hclwrite.Body, stack codegen.Stack) {
+	b := codegen.ResourceBlock(body, l.Resource())
+	codegen.SetInterpolation(b, "name", stack, l.LogGroupName)
+	setInt32Property(b, "retention_in_days", stack, l.LogicalID+".RetentionInDays", l.RetentionInDays)
+}
+
+func (t Topic) WriteHCL(body *hclwrite.Body, stack codegen.Stack) {
+	b := codegen.ResourceBlock(body, t.Resource())
+	name := t.TopicName()
+	codegen.SetInterpolation(b, "name", stack, &name)
+	codegen.SetTags(b, stack)
+}
+
+func (t TopicSubscription) WriteHCL(body *hclwrite.Body, stack codegen.Stack) {
+	b := codegen.ResourceBlock(body, t.Resource())
+	codegen.SetReference(b, "topic_arn", stack, t.Attributes["TopicArn"])
+	b.SetAttributeValue("protocol", cty.StringVal(t.Attributes["Protocol"]))
+	codegen.SetReference(b, "endpoint", stack, t.Attributes["Endpoint"])
+}
+
+func (q Queue) WriteHCL(body *hclwrite.Body, stack codegen.Stack) {
+	b := codegen.ResourceBlock(body, q.Resource())
+	name := q.QueueName()
+	codegen.SetInterpolation(b, "name", stack, &name)
+
+	if rdp := q.RedrivePolicy(); rdp != nil {
+		b.AppendNewline()
+		b.SetAttributeRaw("redrive_policy", codegen.FunctionCall("jsonencode", codegen.Object(
+			codegen.ObjectAttribute{Name: "deadLetterTargetArn", Value: codegen.Reference(stack, rdp.DeadLetterTargetArn)},
+			codegen.ObjectAttribute{Name: "maxReceiveCount", Value: hclwrite.TokensForValue(cty.NumberIntVal(int64(rdp.MaxReceiveCount)))},
+		)))
+	}
+	if policy := q.Policy(); policy != "" {
+		b.AppendNewline()
+		b.SetAttributeRaw("policy", codegen.JSONEncode(policy))
+	}
+
+	b.AppendNewline()
+	codegen.SetTags(b, stack)
+}
+
+// referenceMap returns the tokens for a map of strings, referencing the
+// resources holding its values.
+func referenceMap(stack codegen.Stack, m map[string]string) hclwrite.Tokens {
+	keys := []string{}
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	attrs := []codegen.ObjectAttribute{}
+	for _, k := range keys {
+		attrs = append(attrs, codegen.ObjectAttribute{Name: k, Value: codegen.Reference(stack, m[k])})
+	}
+	return codegen.Object(attrs...)
+}
+
+func decodePolicyDocument(document string) string {
+	decoded, err := url.QueryUnescape(document)
+	if err != nil {
+		return document
+	}
+	return decoded
+}
+
+func setString(body *hclwrite.Body, name string, s *string) {
+	if s != nil {
+		body.SetAttributeValue(name, cty.StringVal(*s))
+	}
+}
+
+func setInt64(body *hclwrite.Body, name string, i *int64) {
+	if i != nil {
+		body.SetAttributeValue(name, cty.NumberIntVal(*i))
+	}
+}
+
+func setInt32(body *hclwrite.Body, name string, i *int32) {
+	if i != nil {
+		body.SetAttributeValue(name, cty.NumberIntVal(int64(*i)))
+	}
+}
+
+// numbered is implemented by stacks converted from a template file, whose
+// numeric properties can be set from references.
+type numbered interface {
+	NumberReference(property string) (string, bool)
+}
+
+// setNumberReference sets an attribute to the reference a numeric property of
+// a template was set from, reporting whether it was.
+func setNumberReference(body *hclwrite.Body, name string, stack codegen.Stack, property string) bool {
+	n, ok := stack.(numbered)
+	if !ok {
+		return false
+	}
+	placeholder, has := n.NumberReference(property)
+	if !has {
+		return false
+	}
+	body.SetAttributeRaw(name, codegen.Reference(stack, placeholder))
+	return true
+}
+
+// setInt64Property sets a numeric attribute converted from the property of a
+// template, which is a reference when the property is set from a parameter.
+func setInt64Property(body *hclwrite.Body, name string, stack codegen.Stack, property string, i *int64) {
+	if !setNumberReference(body, name, stack, property) {
+		setInt64(body, name, i)
+	}
+}
+
+// setInt32Property is setInt64Property for int32 attributes.
+func setInt32Property(body *hclwrite.Body, name string, stack codegen.Stack, property string, i *int32) {
+	if !setNumberReference(body, name, stack, property) {
+		setInt32(body, name, i)
+	}
+}
@@ -0,0 +1,588 @@
+package aws
+
+import (
+	"context"
+	"encoding/json"
+	"strconv"
+	"strings"
+
+	cloudformationTypes "github.com/aws/aws-sdk-go-v2/service/cloudformation/types"
+	"github.com/aws/aws-sdk-go-v2/service/lambda"
+	lambdaTypes "github.com/aws/aws-sdk-go-v2/service/lambda/types"
+	"github.com/cr-norton/tfconvert/pkg/codegen"
+	"github.com/cr-norton/tfconvert/pkg/types"
+	"github.com/hashicorp/hcl/v2/hclwrite"
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+	"github.com/zclconf/go-cty/cty"
+)
+
+// LambdaPermission is a statement of the resource policy of a function. The
+// physical id of an AWS::Lambda::Permission is the id of its statement,
+// prefixed with the function and a | by newer stacks, so the statements are
+// found in the policies of the functions once the stack is fetched.
+type LambdaPermission struct {
+	LogicalID   string
+	StatementID string
+	// FunctionArn is the arn of the function the statement grants access
+	// to, qualified by a version or alias
+	FunctionArn      string
+	Action           string
+	Principal        string
+	SourceArn        *string
+	SourceAccount    *string
+	EventSourceToken *string
+}
+
+// lambdaPermission returns the permission of a physical id, resolved later
+// by resolveLambdaPermissions.
+func lambdaPermission(logicalID string, physicalID string) LambdaPermission {
+	p := LambdaPermission{LogicalID: logicalID, StatementID: physicalID}
+	if i := strings.LastIndex(physicalID, "|"); i >= 0 {
+		p.FunctionArn, p.StatementID = physicalID[:i], physicalID[i+1:]
+	}
+	return p
+}
+
+// policyStatement is a statement of the resource policy of a function
+type policyStatement struct {
+	Sid       string
+	Action    interface{}
+	Principal interface{}
+	Resource  string
+	Condition map[string]map[string]interface{}
+}
+
+// resolveLambdaPermissions completes the permissions of a stack from the
+// statements of the policies of its functions, and of the functions named by
+// the physical ids of permissions. Permissions without a statement are
+// dropped with a warning.
+func (aws *Client) resolveLambdaPermissions(ctx context.Context, stack *StackResources, concurrency int) error {
+	permissions := stack.LambdaPermissions()
+	if len(permissions) == 0 {
+		return nil
+	}
+
+	functions := []string{}
+	seen := map[string]bool{}
+	for _, f := range stack.LambdaFunctions() {
+		seen[*f.FunctionArn] = true
+		functions = append(functions, *f.FunctionArn)
+	}
+	for _, p := range permissions {
+		if p.FunctionArn != "" && !seen[p.FunctionArn] {
+			seen[p.FunctionArn] = true
+			functions = append(functions, p.FunctionArn)
+		}
+	}
+
+	policies := make([][]policyStatement, len(functions))
+	err := forEach(ctx, concurrency, len(functions), func(ctx context.Context, i int) error {
+		res, err := aws.lambda.GetPolicy(ctx, &lambda.GetPolicyInput{
+			FunctionName: &functions[i],
+		})
+		if hasErrorCode(err, "ResourceNotFoundException") {
+			// functions without permissions have no policy
+			return nil
+		}
+		if err != nil {
+			return errors.Wrapf(err, "unable to get policy of %s", functions[i])
+		}
+		var policy struct {
+			Statement []policyStatement
+		}
+		if err := json.Unmarshal([]byte(str(res.Policy)), &policy); err != nil {
+			return errors.Wrapf(err, "unable to parse policy of %s", functions[i])
+		}
+		policies[i] = policy.Statement
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	// sids are only unique within a policy, so statements are found by the
+	// function of the permission and their sid, or by sid alone for physical
+	// ids without the function
+	statements := map[string]policyStatement{}
+	sids := map[string]policyStatement{}
+	for i, policy := range policies {
+		for _, s := range policy {
+			statements[functions[i]+"|"+s.Sid] = s
+			sids[s.Sid] = s
+		}
+	}
+	resolved := []StackResource{}
+	for _, p := range permissions {
+		s, has := sids[p.StatementID]
+		if p.FunctionArn != "" {
+			s, has = statements[p.FunctionArn+"|"+p.StatementID]
+		}
+		if !has {
+			log.WithFields(log.Fields{
+				"logical_id":   p.LogicalID,
+				"function":     p.FunctionArn,
+				"statement_id": p.StatementID,
+			}).Warn("unable to find the policy statement of lambda permission")
+			continue
+		}
+		p.FunctionArn = s.Resource
+		p.Action = policyString(s.Action)
+		p.Principal = policyString(s.Principal)
+		p.SourceArn = s.condition("ArnLike", "AWS:SourceArn")
+		p.SourceAccount = s.condition("StringEquals", "AWS:SourceAccount")
+		p.EventSourceToken = s.condition("StringEquals", "lambda:EventSourceToken")
+		resolved = append(resolved, p)
+	}
+	stack.ByType["AWS::Lambda::Permission"] = resolved
+	return nil
+}
+
+func (s policyStatement) condition(operator string, key string) *string {
+	if v, has := s.Condition[operator][key]; has {
+		value := policyString(v)
+		return &value
+	}
+	return nil
+}
+
+// policyString returns the value of an action or principal of a statement,
+// such as {"Service": "sns.amazonaws.com"}.
+func policyString(v interface{}) string {
+	switch s := v.(type) {
+	case string:
+		return s
+	case []interface{}:
+		if len(s) > 0 {
+			return policyString(s[0])
+		}
+	case map[string]interface{}:
+		for _, k := range []string{"Service", "AWS"} {
+			if p, has := s[k]; has {
+				return policyString(p)
+			}
+		}
+	}
+	return ""
+}
+
+// function returns the unqualified arn and the qualifier of the function of
+// the permission.
+func (p LambdaPermission) function() (string, string) {
+	return splitFunctionArn(p.FunctionArn)
+}
+
+func (p LambdaPermission) Resource() types.Resource {
+	arn, qualifier := p.function()
+	name := functionName(arn)
+	if qualifier != "" {
+		name += ":" + qualifier
+	}
+	return types.Resource{
+		Type:       "aws_lambda_permission",
+		Identifier: p.LogicalID,
+		ImportKey:  name + "/" + p.StatementID,
+		OutputKey:  "id",
+	}
+}
+
+func (p LambdaPermission) WriteHCL(body *hclwrite.Body, stack codegen.Stack) {
+	b := codegen.ResourceBlock(body, p.Resource())
+	b.SetAttributeValue("statement_id", cty.StringVal(p.StatementID))
+	b.SetAttributeValue("action", cty.StringVal(p.Action))
+	arn, qualifier := p.function()
+	alias := stack.Lookup(p.FunctionArn)
+	if alias != nil && alias.Type == "aws_lambda_alias" && qualifier == "" {
+		// the arn of an alias of a template isn't qualified until deployed
+		b.SetAttributeTraversal("function_name", codegen.Traversal(alias.Type, codegen.Name(alias.Identifier), "function_name"))
+	} else {
+		codegen.SetReference(b, "function_name", stack, arn)
+	}
+	if alias != nil && alias.Type == "aws_lambda_alias" {
+		b.SetAttributeTraversal("qualifier", codegen.Traversal(alias.Type, codegen.Name(alias.Identifier), "name"))
+	} else if qualifier != "" {
+		b.SetAttributeValue("qualifier", cty.StringVal(qualifier))
+	}
+	b.SetAttributeValue("principal", cty.StringVal(p.Principal))
+	if p.SourceArn != nil {
+		codegen.SetReference(b, "source_arn", stack, *p.SourceArn)
+	}
+	setString(b, "source_account", p.SourceAccount)
+	setString(b, "event_source_token", p.EventSourceToken)
+}
+
+// splitFunctionArn returns the unqualified arn and the version or alias of a
+// function arn such as arn:aws:lambda:us-east-1:123456789012:function:name:alias
+func splitFunctionArn(arn string) (string, string) {
+	parts := strings.Split(arn, ":")
+	if len(parts) == 8 {
+		return strings.Join(parts[:7], ":"), parts[7]
+	}
+	return arn, ""
+}
+
+// functionName returns the name of a function, or layer, from its unqualified arn
+func functionName(arn string) string {
+	return arn[strings.LastIndex(arn, ":")+1:]
+}
+
+// getProvisionedConcurrency returns the provisioned concurrency of a version
+// or alias, if any.
+func (aws *Client) getProvisionedConcurrency(ctx context.Context, functionArn string, qualifier string) (*int32, error) {
+	res, err := aws.lambda.GetProvisionedConcurrencyConfig(ctx, &lambda.GetProvisionedConcurrencyConfigInput{
+		FunctionName: &functionArn,
+		Qualifier:    &qualifier,
+	})
+	if hasErrorCode(err, "ProvisionedConcurrencyConfigNotFoundException") {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return res.RequestedProvisionedConcurrentExecutions, nil
+}
+
+// lambdaVersionType is the resource type of the versions of functions, which
+// aren't converted by a handler as terraform publishes them with the function
+const lambdaVersionType = "AWS::Lambda::Version"
+
+// LambdaVersion is a version of a function published by the stack. Terraform
+// publishes versions with the function, so versions are moved to their
+// function by resolveLambdaVersions once the stack is fetched, leaving their
+// provisioned concurrency as a resource of its own.
+type LambdaVersion struct {
+	LogicalID string
+	// FunctionArn is the arn of the version, qualified by its number
+	FunctionArn            string
+	Version                string
+	ProvisionedConcurrency *int32
+}
+
+func (aws *Client) GetLambdaVersion(ctx context.Context, logicalID string, versionArn string) (*LambdaVersion, error) {
+	arn, version := splitFunctionArn(versionArn)
+	concurrency, err := aws.getProvisionedConcurrency(ctx, arn, version)
+	if err != nil {
+		return nil, err
+	}
+	return &LambdaVersion{
+		LogicalID:              logicalID,
+		FunctionArn:            versionArn,
+		Version:                version,
+		ProvisionedConcurrency: concurrency,
+	}, nil
+}
+
+// provisionedConcurrency returns the provisioned concurrency config of the
+// version, a child resource of its function.
+func (v LambdaVersion) provisionedConcurrency() types.Resource {
+	arn, _ := splitFunctionArn(v.FunctionArn)
+	return types.Resource{
+		Type:       "aws_lambda_provisioned_concurrency_config",
+		Identifier: v.LogicalID,
+		ImportKey:  functionName(arn) + ":" + v.Version,
+		OutputKey:  "id",
+	}
+}
+
+// getLambdaVersions fetches the versions of a stack. Versions that can't be
+// fetched are returned as failures when continuing on errors.
+func (aws *Client) getLambdaVersions(ctx context.Context, resources []cloudformationTypes.StackResourceSummary, options types.Options) ([]LambdaVersion, []Failure, error) {
+	versions := make([]*LambdaVersion, len(resources))
+	failed := make([]error, len(resources))
+	err := forEach(ctx, options.Concurrency, len(resources), func(ctx context.Context, i int) error {
+		r := resources[i]
+		v, err := aws.GetLambdaVersion(ctx, *r.LogicalResourceId, *r.PhysicalResourceId)
+		if err != nil && options.ContinueOnError && ctx.Err() == nil {
+			log.WithFields(log.Fields{
+				"resource_type": lambdaVersionType,
+				"logical_id":    *r.LogicalResourceId,
+				"physical_id":   *r.PhysicalResourceId,
+			}).Warnf("unable to fetch resource: %v", err)
+			failed[i] = err
+			return nil
+		}
+		if err != nil {
+			return errors.Wrapf(err, "unable to fetch %s %s", lambdaVersionType, *r.LogicalResourceId)
+		}
+		versions[i] = v
+		return nil
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+
+	fetched := []LambdaVersion{}
+	failures := []Failure{}
+	for i, r := range resources {
+		if failed[i] != nil {
+			failures = append(failures, Failure{
+				ResourceType: lambdaVersionType,
+				LogicalID:    *r.LogicalResourceId,
+				PhysicalID:   *r.PhysicalResourceId,
+				Error:        failed[i].Error(),
+			})
+			continue
+		}
+		fetched = append(fetched, *versions[i])
+	}
+	return fetched, failures, nil
+}
+
+// resolveLambdaVersions moves the versions of a stack to their functions,
+// along with the latest version published, so references to it are written
+// as the qualified_arn of the function. Versions of functions outside the
+// stack are dropped with a warning.
+func (aws *Client) resolveLambdaVersions(ctx context.Context, stack *StackResources, fetched []LambdaVersion, concurrency int) error {
+	versions := map[string][]LambdaVersion{}
+	for _, v := range fetched {
+		arn, _ := splitFunctionArn(v.FunctionArn)
+		versions[arn] = append(versions[arn], v)
+	}
+	if len(versions) == 0 {
+		return nil
+	}
+
+	functions := stack.ByType["AWS::Lambda::Function"]
+	latest := make([]string, len(functions))
+	err := forEach(ctx, concurrency, len(functions), func(ctx context.Context, i int) error {
+		f := functions[i].(LambdaFunctionConfiguration)
+		if len(versions[*f.FunctionArn]) == 0 {
+			return nil
+		}
+		input := &lambda.ListVersionsByFunctionInput{FunctionName: f.FunctionArn}
+		for {
+			res, err := aws.lambda.ListVersionsByFunction(ctx, input)
+			if err != nil {
+				return errors.Wrapf(err, "unable to list versions of %s", *f.FunctionName)
+			}
+			for _, v := range res.Versions {
+				if laterVersion(str(v.Version), latest[i]) {
+					latest[i] = *v.Version
+				}
+			}
+			if res.NextMarker == nil {
+				break
+			}
+			input.Marker = res.NextMarker
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	for i, r := range functions {
+		f := r.(LambdaFunctionConfiguration)
+		f.Versions = versions[*f.FunctionArn]
+		f.LatestVersion = latest[i]
+		functions[i] = f
+		delete(versions, *f.FunctionArn)
+	}
+	for arn, vs := range versions {
+		for _, v := range vs {
+			log.WithFields(log.Fields{
+				"logical_id": v.LogicalID,
+				"function":   arn,
+			}).Warn("unable to convert the version of a function outside the stack")
+		}
+	}
+	return nil
+}
+
+// laterVersion reports whether version is published after latest, skipping $LATEST
+func laterVersion(version string, latest string) bool {
+	n, err := strconv.Atoi(version)
+	if err != nil {
+		return false
+	}
+	l, _ := strconv.Atoi(latest)
+	return n > l
+}
+
+// versionReference returns the tokens for a version of the function of arn,
+// referencing the version of the function when it is the latest published,
+// or when the version is a reference to it such as those of templates.
+func versionReference(stack codegen.Stack, arn string, version string) hclwrite.Tokens {
+	if res := stack.Lookup(arn + ":" + version); res != nil && res.Type == "aws_lambda_function" {
+		return hclwrite.TokensForTraversal(codegen.Traversal(res.Type, codegen.Name(res.Identifier), "version"))
+	}
+	if res := stack.Lookup(version); res != nil && res.Type == "aws_lambda_function" && res.OutputKey == "version" {
+		return hclwrite.TokensForTraversal(codegen.Traversal(res.Type, codegen.Name(res.Identifier), "version"))
+	}
+	return hclwrite.TokensForValue(cty.StringVal(version))
+}
+
+// LambdaAlias is an alias of a function, with the weights of the versions it
+// routes traffic to and its provisioned concurrency.
+type LambdaAlias struct {
+	LogicalID string
+	lambdaTypes.AliasConfiguration
+	// FunctionArn is the unqualified arn of the function of the alias
+	FunctionArn            string
+	ProvisionedConcurrency *int32
+}
+
+func (aws *Client) GetLambdaAlias(ctx context.Context, logicalID string, aliasArn string) (*LambdaAlias, error) {
+	arn, name := splitFunctionArn(aliasArn)
+	res, err := aws.lambda.GetAlias(ctx, &lambda.GetAliasInput{
+		FunctionName: &arn,
+		Name:         &name,
+	})
+	if err != nil {
+		return nil, err
+	}
+	concurrency, err := aws.getProvisionedConcurrency(ctx, arn, name)
+	if err != nil {
+		return nil, err
+	}
+	return &LambdaAlias{
+		LogicalID: logicalID,
+		AliasConfiguration: lambdaTypes.AliasConfiguration{
+			AliasArn:        res.AliasArn,
+			Name:            res.Name,
+			Description:     res.Description,
+			FunctionVersion: res.FunctionVersion,
+			RoutingConfig:   res.RoutingConfig,
+		},
+		FunctionArn:            arn,
+		ProvisionedConcurrency: concurrency,
+	}, nil
+}
+
+func (a LambdaAlias) Key() string {
+	return *a.AliasArn
+}
+
+// function returns the function of the alias, read from the arn of the alias
+// by snapshots without it.
+func (a LambdaAlias) function() string {
+	if a.FunctionArn != "" {
+		return a.FunctionArn
+	}
+	arn, _ := splitFunctionArn(*a.AliasArn)
+	return arn
+}
+
+func (a LambdaAlias) Resource() types.Resource {
+	return types.Resource{
+		Type:       "aws_lambda_alias",
+		Identifier: a.LogicalID,
+		ImportKey:  functionName(a.function()) + "/" + *a.Name,
+		OutputKey:  "arn",
+	}
+}
+
+func (a LambdaAlias) ReturnValues() map[string]ReturnValue {
+	return map[string]ReturnValue{
+		"Ref": {"arn", *a.AliasArn},
+	}
+}
+
+// ChildResources returns the provisioned concurrency of the alias, which
+// terraform manages as a separate resource.
+func (a LambdaAlias) ChildResources() []types.Resource {
+	if a.ProvisionedConcurrency == nil {
+		return nil
+	}
+	return []types.Resource{a.provisionedConcurrency()}
+}
+
+func (a LambdaAlias) provisionedConcurrency() types.Resource {
+	return types.Resource{
+		Type:       "aws_lambda_provisioned_concurrency_config",
+		Identifier: a.LogicalID,
+		ImportKey:  functionName(a.function()) + ":" + *a.Name,
+		OutputKey:  "id",
+	}
+}
+
+func (a LambdaAlias) WriteHCL(body *hclwrite.Body, stack codegen.Stack) {
+	alias := a.Resource()
+	b := codegen.ResourceBlock(body, alias)
+	setString(b, "name", a.Name)
+	setString(b, "description", a.Description)
+	codegen.SetReference(b, "function_name", stack, a.function())
+	if a.FunctionVersion != nil {
+		b.SetAttributeRaw("function_version", versionReference(stack, a.function(), *a.FunctionVersion))
+	}
+	if a.RoutingConfig != nil && len(a.RoutingConfig.AdditionalVersionWeights) > 0 {
+		weights := map[string]cty.Value{}
+		for version, weight := range a.RoutingConfig.AdditionalVersionWeights {
+			weights[version] = cty.NumberFloatVal(weight)
+		}
+		b.AppendNewline()
+		rb := b.AppendNewBlock("routing_config", nil).Body()
+		rb.SetAttributeValue("additional_version_weights", cty.MapVal(weights))
+	}
+
+	if a.ProvisionedConcurrency != nil {
+		body.AppendNewline()
+		pb := codegen.ResourceBlock(body, a.provisionedConcurrency())
+		pb.SetAttributeTraversal("function_name", codegen.Traversal(alias.Type, codegen.Name(alias.Identifier), "function_name"))
+		pb.SetAttributeTraversal("qualifier", codegen.Traversal(alias.Type, codegen.Name(alias.Identifier), "name"))
+		setInt32Property(pb, "provisioned_concurrent_executions", stack, a.LogicalID+".ProvisionedConcurrencyConfig.ProvisionedConcurrentExecutions", a.ProvisionedConcurrency)
+	}
+}
+
+// LambdaLayerVersion is a version of a layer. Its content isn't converted, as
+// with functions a placeholder package is written instead.
+type LambdaLayerVersion struct {
+	LogicalID          string
+	LayerArn           string
+	LayerVersionArn    string
+	Description        *string
+	CompatibleRuntimes []lambdaTypes.Runtime
+	LicenseInfo        *string
+}
+
+func (aws *Client) GetLambdaLayerVersion(ctx context.Context, logicalID string, layerVersionArn string) (*LambdaLayerVersion, error) {
+	res, err := aws.lambda.GetLayerVersionByArn(ctx, &lambda.GetLayerVersionByArnInput{
+		Arn: &layerVersionArn,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &LambdaLayerVersion{
+		LogicalID:          logicalID,
+		LayerArn:           str(res.LayerArn),
+		LayerVersionArn:    str(res.LayerVersionArn),
+		Description:        res.Description,
+		CompatibleRuntimes: res.CompatibleRuntimes,
+		LicenseInfo:        res.LicenseInfo,
+	}, nil
+}
+
+func (l LambdaLayerVersion) Key() string {
+	return l.LayerVersionArn
+}
+
+func (l LambdaLayerVersion) Resource() types.Resource {
+	return types.Resource{
+		Type:       "aws_lambda_layer_version",
+		Identifier: l.LogicalID,
+		ImportKey:  l.LayerVersionArn,
+		OutputKey:  "arn",
+	}
+}
+
+func (l LambdaLayerVersion) ReturnValues() map[string]ReturnValue {
+	return map[string]ReturnValue{
+		"Ref": {"arn", l.LayerVersionArn},
+	}
+}
+
+func (l LambdaLayerVersion) WriteHCL(body *hclwrite.Body, stack codegen.Stack) {
+	b := codegen.ResourceBlock(body, l.Resource())
+	b.SetAttributeValue("filename", cty.StringVal("lambda_layer_payload.zip"))
+	name := functionName(l.LayerArn)
+	codegen.SetInterpolation(b, "layer_name", stack, &name)
+	setString(b, "description", l.Description)
+	if len(l.CompatibleRuntimes) > 0 {
+		runtimes := []string{}
+		for _, r := range l.CompatibleRuntimes {
+			runtimes = append(runtimes, string(r))
+		}
+		b.SetAttributeValue("compatible_runtimes", codegen.StringList(runtimes))
+	}
+	setString(b, "license_info", l.LicenseInfo)
+}
@@ -0,0 +1,210 @@
+package aws
+
+import (
+	"context"
+	"math/big"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/service/cloudformation"
+	"github.com/cr-norton/tfconvert/pkg/codegen"
+	"github.com/hashicorp/hcl/v2/hclsyntax"
+	"github.com/hashicorp/hcl/v2/hclwrite"
+	"github.com/pkg/errors"
+	"github.com/zclconf/go-cty/cty"
+)
+
+// Parameter is a parameter of the stack, converted to a terraform variable.
+type Parameter struct {
+	Key         string  `json:"key"`
+	Type        string  `json:"type"`
+	Default     *string `json:"default,omitempty"`
+	Description string  `json:"description,omitempty"`
+	NoEcho      bool    `json:"no_echo,omitempty"`
+	// Value is the current value of the parameter, masked for NoEcho parameters
+	Value string `json:"value"`
+}
+
+// Output is an output of the stack, converted to a terraform output.
+type Output struct {
+	Key         string `json:"key"`
+	Value       string `json:"value"`
+	Description string `json:"description,omitempty"`
+	ExportName  string `json:"export_name,omitempty"`
+}
+
+// StackInterface is the id, parameters and outputs of a deployed stack.
+type StackInterface struct {
+	StackID    string
+	Parameters []Parameter
+	Outputs    []Output
+}
+
+// GetStackInterface returns the parameters and outputs of a stack. Parameter
+// declarations come from the template, values from the deployed stack.
+func (aws *Client) GetStackInterface(ctx context.Context, stackName string) (*StackInterface, error) {
+	summary, err := aws.cloudformation.GetTemplateSummary(ctx, &cloudformation.GetTemplateSummaryInput{StackName: &stackName})
+	if err != nil {
+		return nil, errors.Wrapf(err, "unable to get template summary of %s", stackName)
+	}
+	res, err := aws.cloudformation.DescribeStacks(ctx, &cloudformation.DescribeStacksInput{StackName: &stackName})
+	if err != nil {
+		return nil, errors.Wrapf(err, "unable to describe stack %s", stackName)
+	}
+	if len(res.Stacks) == 0 {
+		return nil, errors.Errorf("stack %s not found", stackName)
+	}
+	stack := res.Stacks[0]
+
+	values := map[string]string{}
+	for _, p := range stack.Parameters {
+		if p.ParameterKey != nil && p.ParameterValue != nil {
+			values[*p.ParameterKey] = *p.ParameterValue
+		}
+	}
+
+	parameters := []Parameter{}
+	for _, p := range summary.Parameters {
+		parameter := Parameter{Key: *p.ParameterKey, Value: values[*p.ParameterKey]}
+		if p.ParameterType != nil {
+			parameter.Type = *p.ParameterType
+		}
+		parameter.Default = p.DefaultValue
+		if p.Description != nil {
+			parameter.Description = *p.Description
+		}
+		if p.NoEcho != nil {
+			parameter.NoEcho = *p.NoEcho
+		}
+		parameters = append(parameters, parameter)
+	}
+
+	outputs := []Output{}
+	for _, o := range stack.Outputs {
+		output := Output{Key: *o.OutputKey}
+		if o.OutputValue != nil {
+			output.Value = *o.OutputValue
+		}
+		if o.Description != nil {
+			output.Description = *o.Description
+		}
+		if o.ExportName != nil {
+			output.ExportName = *o.ExportName
+		}
+		outputs = append(outputs, output)
+	}
+	return &StackInterface{
+		StackID:    *stack.StackId,
+		Parameters: parameters,
+		Outputs:    outputs,
+	}, nil
+}
+
+// Name returns the name of the variable of the parameter.
+func (p Parameter) Name() string {
+	return codegen.Name(p.Key)
+}
+
+// VariableType returns the terraform type of the parameter. Lists of aws
+// specific types are lists of strings, and every other type is a string.
+func (p Parameter) VariableType() hclwrite.Tokens {
+	switch {
+	case p.Type == "Number":
+		return hclwrite.TokensForTraversal(codegen.Traversal("number"))
+	case p.Type == "List<Number>":
+		return codegen.FunctionCall("list", hclwrite.TokensForTraversal(codegen.Traversal("number")))
+	case p.isList():
+		return codegen.FunctionCall("list", hclwrite.TokensForTraversal(codegen.Traversal("string")))
+	}
+	return hclwrite.TokensForTraversal(codegen.Traversal("string"))
+}
+
+// isList reports whether the parameter holds a list, including lists read
+// from SSM such as AWS::SSM::Parameter::Value<List<String>>.
+func (p Parameter) isList() bool {
+	return strings.Contains(p.Type, "List<") || strings.Contains(p.Type, "CommaDelimitedList")
+}
+
+// value converts a parameter value to the terraform type of the parameter.
+func (p Parameter) value(s string) cty.Value {
+	element := func(s string) cty.Value {
+		if strings.HasSuffix(p.Type, "Number") || strings.HasSuffix(p.Type, "Number>") {
+			if n, ok := new(big.Float).SetString(strings.TrimSpace(s)); ok {
+				return cty.NumberVal(n)
+			}
+		}
+		return cty.StringVal(s)
+	}
+	if !p.isList() {
+		return element(s)
+	}
+	if s == "" {
+		return cty.ListValEmpty(element("").Type())
+	}
+	vals := []cty.Value{}
+	for _, e := range strings.Split(s, ",") {
+		vals = append(vals, element(strings.TrimSpace(e)))
+	}
+	return cty.TupleVal(vals)
+}
+
+// WriteHCL writes the variable declaring the parameter.
+func (p Parameter) WriteHCL(body *hclwrite.Body, stack codegen.Stack) {
+	writeVariable(body, p.Name(), p)
+}
+
+func writeVariable(body *hclwrite.Body, name string, p Parameter) {
+	b := body.AppendNewBlock("variable", []string{name}).Body()
+	b.SetAttributeRaw("type", p.VariableType())
+	if p.Description != "" {
+		b.SetAttributeValue("description", cty.StringVal(p.Description))
+	}
+	if p.Default != nil {
+		b.SetAttributeValue("default", p.value(*p.Default))
+	}
+	if p.NoEcho {
+		b.SetAttributeValue("sensitive", cty.True)
+	}
+}
+
+// parameterValue is the current value of a parameter, written to terraform.tfvars.
+type parameterValue struct {
+	name string
+	Parameter
+}
+
+func (p parameterValue) WriteHCL(body *hclwrite.Body, stack codegen.Stack) {
+	if p.NoEcho {
+		body.AppendUnstructuredTokens(hclwrite.Tokens{
+			{Type: hclsyntax.TokenComment, Bytes: []byte("# " + p.name + " is NoEcho, its value can't be read from the stack\n")},
+		})
+		return
+	}
+	body.SetAttributeValue(p.name, p.value(p.Value))
+}
+
+// WriteHCL writes the terraform output of the output, referencing the
+// resource holding its value when the value is indexed.
+func (o Output) WriteHCL(body *hclwrite.Body, stack codegen.Stack) {
+	b := body.AppendNewBlock("output", []string{codegen.Name(o.Key)}).Body()
+	if o.Description != "" {
+		b.SetAttributeValue("description", cty.StringVal(o.Description))
+	}
+	codegen.SetReference(b, "value", stack, o.Value)
+}
+
+// interfaceBlocks returns the variables, their values and the outputs of the
+// stack, keyed by the file they are written to. Values are only known for
+// deployed stacks.
+func (s Stack) interfaceBlocks() map[string][]codegen.HCLResource {
+	files := map[string][]codegen.HCLResource{}
+	for _, p := range s.Parameters {
+		files["variables.tmpl"] = append(files["variables.tmpl"], p)
+		if s.StackID != "" {
+			files["terraform.tfvars"] = append(files["terraform.tfvars"], parameterValue{name: p.Name(), Parameter: p})
+		}
+	}
+	for _, o := range s.Outputs {
+		files["outputs.tmpl"] = append(files["outputs.tmpl"], o)
+	}
+	return files
+}
@@ -0,0 +1,463 @@
+package aws
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	s3Types "github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/cr-norton/tfconvert/pkg/codegen"
+	"github.com/cr-norton/tfconvert/pkg/types"
+	"github.com/hashicorp/hcl/v2/hclwrite"
+	"github.com/pkg/errors"
+	"github.com/zclconf/go-cty/cty"
+)
+
+// Bucket is an s3 bucket with its configuration, which terraform manages as
+// a resource of its own for each part configured.
+type Bucket struct {
+	LogicalID         string
+	Name              string
+	VersioningStatus  s3Types.BucketVersioningStatus
+	MFADelete         s3Types.MFADeleteStatus
+	Encryption        []s3Types.ServerSideEncryptionRule
+	LifecycleRules    []LifecycleRule
+	CORSRules         []s3Types.CORSRule
+	Notifications     *BucketNotifications
+	PublicAccessBlock *s3Types.PublicAccessBlockConfiguration
+	Logging           *s3Types.LoggingEnabled
+	// Partition is the partition of the stack of the bucket, which its arn
+	// and domain name are in
+	Partition string
+}
+
+// LifecycleRule is a lifecycle rule of a bucket. The filter of the rule, a
+// union the snapshot can't decode, is kept as its prefix and tags.
+type LifecycleRule struct {
+	s3Types.LifecycleRule
+	FilterPrefix *string
+	FilterTags   []s3Types.Tag
+}
+
+// BucketNotifications are the functions, queues and topics notified of the
+// events of a bucket.
+type BucketNotifications struct {
+	LambdaFunctionConfigurations []s3Types.LambdaFunctionConfiguration
+	QueueConfigurations          []s3Types.QueueConfiguration
+	TopicConfigurations          []s3Types.TopicConfiguration
+}
+
+func (aws *Client) GetBucket(ctx context.Context, logicalID string, bucketName string) (*Bucket, error) {
+	b := &Bucket{LogicalID: logicalID, Name: bucketName}
+
+	versioning, err := aws.s3.GetBucketVersioning(ctx, &s3.GetBucketVersioningInput{
+		Bucket: &bucketName,
+	})
+	if err != nil {
+		return nil, errors.Wrap(err, "unable to get bucket versioning")
+	}
+	b.VersioningStatus, b.MFADelete = versioning.Status, versioning.MFADelete
+
+	encryption, err := aws.s3.GetBucketEncryption(ctx, &s3.GetBucketEncryptionInput{
+		Bucket: &bucketName,
+	})
+	if err != nil && !hasErrorCode(err, "ServerSideEncryptionConfigurationNotFoundError") {
+		return nil, errors.Wrap(err, "unable to get bucket encryption")
+	}
+	if err == nil && encryption.ServerSideEncryptionConfiguration != nil {
+		b.Encryption = encryption.ServerSideEncryptionConfiguration.Rules
+	}
+
+	lifecycle, err := aws.s3.GetBucketLifecycleConfiguration(ctx, &s3.GetBucketLifecycleConfigurationInput{
+		Bucket: &bucketName,
+	})
+	if err != nil && !hasErrorCode(err, "NoSuchLifecycleConfiguration") {
+		return nil, errors.Wrap(err, "unable to get bucket lifecycle")
+	}
+	if err == nil {
+		for _, r := range lifecycle.Rules {
+			b.LifecycleRules = append(b.LifecycleRules, lifecycleRule(r))
+		}
+	}
+
+	cors, err := aws.s3.GetBucketCors(ctx, &s3.GetBucketCorsInput{
+		Bucket: &bucketName,
+	})
+	if err != nil && !hasErrorCode(err, "NoSuchCORSConfiguration") {
+		return nil, errors.Wrap(err, "unable to get bucket cors")
+	}
+	if err == nil {
+		b.CORSRules = cors.CORSRules
+	}
+
+	notifications, err := aws.s3.GetBucketNotificationConfiguration(ctx, &s3.GetBucketNotificationConfigurationInput{
+		Bucket: &bucketName,
+	})
+	if err != nil {
+		return nil, errors.Wrap(err, "unable to get bucket notifications")
+	}
+	if len(notifications.LambdaFunctionConfigurations)+len(notifications.QueueConfigurations)+len(notifications.TopicConfigurations) > 0 {
+		b.Notifications = &BucketNotifications{
+			LambdaFunctionConfigurations: notifications.LambdaFunctionConfigurations,
+			QueueConfigurations:          notifications.QueueConfigurations,
+			TopicConfigurations:          notifications.TopicConfigurations,
+		}
+	}
+
+	block, err := aws.s3.GetPublicAccessBlock(ctx, &s3.GetPublicAccessBlockInput{
+		Bucket: &bucketName,
+	})
+	if err != nil && !hasErrorCode(err, "NoSuchPublicAccessBlockConfiguration") {
+		return nil, errors.Wrap(err, "unable to get bucket public access block")
+	}
+	if err == nil {
+		b.PublicAccessBlock = block.PublicAccessBlockConfiguration
+	}
+
+	logging, err := aws.s3.GetBucketLogging(ctx, &s3.GetBucketLoggingInput{
+		Bucket: &bucketName,
+	})
+	if err != nil {
+		return nil, errors.Wrap(err, "unable to get bucket logging")
+	}
+	b.Logging = logging.LoggingEnabled
+	return b, nil
+}
+
+func lifecycleRule(r s3Types.LifecycleRule) LifecycleRule {
+	rule := LifecycleRule{LifecycleRule: r}
+	switch f := r.Filter.(type) {
+	case *s3Types.LifecycleRuleFilterMemberPrefix:
+		rule.FilterPrefix = &f.Value
+	case *s3Types.LifecycleRuleFilterMemberTag:
+		rule.FilterTags = []s3Types.Tag{f.Value}
+	case *s3Types.LifecycleRuleFilterMemberAnd:
+		rule.FilterPrefix = f.Value.Prefix
+		rule.FilterTags = f.Value.Tags
+	}
+	rule.Filter = nil
+	return rule
+}
+
+func (b Bucket) Key() string {
+	return b.arn()
+}
+
+func (b Bucket) arn() string {
+	return "arn:" + b.partition() + ":s3:::" + b.Name
+}
+
+// partition returns the partition of the bucket, aws for snapshots taken
+// before it was recorded.
+func (b Bucket) partition() string {
+	if b.Partition == "" {
+		return "aws"
+	}
+	return b.Partition
+}
+
+func (b Bucket) inPartition(partition string) StackResource {
+	b.Partition = partition
+	return b
+}
+
+func (b Bucket) Resource() types.Resource {
+	return types.Resource{
+		Type:       "aws_s3_bucket",
+		Identifier: b.LogicalID,
+		ImportKey:  b.Name,
+		OutputKey:  "arn",
+	}
+}
+
+func (b Bucket) ReturnValues() map[string]ReturnValue {
+	return map[string]ReturnValue{
+		"Ref":        {"id", b.Name},
+		"Arn":        {"arn", b.arn()},
+		"DomainName": {"bucket_domain_name", b.Name + ".s3." + dnsSuffix(b.partition())},
+	}
+}
+
+// ChildResources returns the configured parts of the bucket, each imported by
+// the name of the bucket.
+func (b Bucket) ChildResources() []types.Resource {
+	resources := []types.Resource{}
+	for _, child := range []struct {
+		resourceType string
+		configured   bool
+	}{
+		{"aws_s3_bucket_versioning", b.VersioningStatus != ""},
+		{"aws_s3_bucket_server_side_encryption_configuration", len(b.Encryption) > 0},
+		{"aws_s3_bucket_lifecycle_configuration", len(b.LifecycleRules) > 0},
+		{"aws_s3_bucket_cors_configuration", len(b.CORSRules) > 0},
+		{"aws_s3_bucket_notification", b.Notifications != nil},
+		{"aws_s3_bucket_public_access_block", b.PublicAccessBlock != nil},
+		{"aws_s3_bucket_logging", b.Logging != nil},
+	} {
+		if child.configured {
+			resources = append(resources, b.child(child.resourceType))
+		}
+	}
+	return resources
+}
+
+func (b Bucket) child(resourceType string) types.Resource {
+	return types.Resource{
+		Type:       resourceType,
+		Identifier: b.LogicalID,
+		ImportKey:  b.Name,
+		OutputKey:  "id",
+	}
+}
+
+func (b Bucket) WriteHCL(body *hclwrite.Body, stack codegen.Stack) {
+	bucket := b.Resource()
+	bucketID := codegen.Traversal(bucket.Type, codegen.Name(bucket.Identifier), "id")
+	bb := codegen.ResourceBlock(body, bucket)
+	codegen.SetInterpolation(bb, "bucket", stack, &b.Name)
+	bb.AppendNewline()
+	codegen.SetTags(bb, stack)
+
+	if b.VersioningStatus != "" {
+		body.AppendNewline()
+		vb := codegen.ResourceBlock(body, b.child("aws_s3_bucket_versioning"))
+		vb.SetAttributeTraversal("bucket", bucketID)
+		vb.AppendNewline()
+		cb := vb.AppendNewBlock("versioning_configuration", nil).Body()
+		cb.SetAttributeValue("status", cty.StringVal(string(b.VersioningStatus)))
+		if b.MFADelete != "" {
+			cb.SetAttributeValue("mfa_delete", cty.StringVal(string(b.MFADelete)))
+		}
+	}
+
+	if len(b.Encryption) > 0 {
+		body.AppendNewline()
+		eb := codegen.ResourceBlock(body, b.child("aws_s3_bucket_server_side_encryption_configuration"))
+		eb.SetAttributeTraversal("bucket", bucketID)
+		for _, r := range b.Encryption {
+			eb.AppendNewline()
+			rb := eb.AppendNewBlock("rule", nil).Body()
+			if r.BucketKeyEnabled {
+				rb.SetAttributeValue("bucket_key_enabled", cty.True)
+			}
+			if d := r.ApplyServerSideEncryptionByDefault; d != nil {
+				db := rb.AppendNewBlock("apply_server_side_encryption_by_default", nil).Body()
+				db.SetAttributeValue("sse_algorithm", cty.StringVal(string(d.SSEAlgorithm)))
+				if d.KMSMasterKeyID != nil {
+					codegen.SetReference(db, "kms_master_key_id", stack, *d.KMSMasterKeyID)
+				}
+			}
+		}
+	}
+
+	if len(b.LifecycleRules) > 0 {
+		body.AppendNewline()
+		lb := codegen.ResourceBlock(body, b.child("aws_s3_bucket_lifecycle_configuration"))
+		lb.SetAttributeTraversal("bucket", bucketID)
+		for _, r := range b.LifecycleRules {
+			lb.AppendNewline()
+			writeLifecycleRule(lb.AppendNewBlock("rule", nil).Body(), r)
+		}
+	}
+
+	if len(b.CORSRules) > 0 {
+		body.AppendNewline()
+		cb := codegen.ResourceBlock(body, b.child("aws_s3_bucket_cors_configuration"))
+		cb.SetAttributeTraversal("bucket", bucketID)
+		for _, r := range b.CORSRules {
+			cb.AppendNewline()
+			rb := cb.AppendNewBlock("cors_rule", nil).Body()
+			setString(rb, "id", r.ID)
+			for _, attr := range []struct {
+				name   string
+				values []string
+			}{
+				{"allowed_headers", r.AllowedHeaders},
+				{"allowed_methods", r.AllowedMethods},
+				{"allowed_origins", r.AllowedOrigins},
+				{"expose_headers", r.ExposeHeaders},
+			} {
+				if len(attr.values) > 0 {
+					rb.SetAttributeValue(attr.name, codegen.StringList(attr.values))
+				}
+			}
+			if r.MaxAgeSeconds != 0 {
+				rb.SetAttributeValue("max_age_seconds", cty.NumberIntVal(int64(r.MaxAgeSeconds)))
+			}
+		}
+	}
+
+	if n := b.Notifications; n != nil {
+		body.AppendNewline()
+		nb := codegen.ResourceBlock(body, b.child("aws_s3_bucket_notification"))
+		nb.SetAttributeTraversal("bucket", bucketID)
+		for _, c := range n.LambdaFunctionConfigurations {
+			nb.AppendNewline()
+			writeNotification(nb.AppendNewBlock("lambda_function", nil).Body(), stack, c.Id, "lambda_function_arn", c.LambdaFunctionArn, c.Events, c.Filter)
+		}
+		for _, c := range n.QueueConfigurations {
+			nb.AppendNewline()
+			writeNotification(nb.AppendNewBlock("queue", nil).Body(), stack, c.Id, "queue_arn", c.QueueArn, c.Events, c.Filter)
+		}
+		for _, c := range n.TopicConfigurations {
+			nb.AppendNewline()
+			writeNotification(nb.AppendNewBlock("topic", nil).Body(), stack, c.Id, "topic_arn", c.TopicArn, c.Events, c.Filter)
+		}
+	}
+
+	if p := b.PublicAccessBlock; p != nil {
+		body.AppendNewline()
+		pb := codegen.ResourceBlock(body, b.child("aws_s3_bucket_public_access_block"))
+		pb.SetAttributeTraversal("bucket", bucketID)
+		pb.SetAttributeValue("block_public_acls", cty.BoolVal(p.BlockPublicAcls))
+		pb.SetAttributeValue("block_public_policy", cty.BoolVal(p.BlockPublicPolicy))
+		pb.SetAttributeValue("ignore_public_acls", cty.BoolVal(p.IgnorePublicAcls))
+		pb.SetAttributeValue("restrict_public_buckets", cty.BoolVal(p.RestrictPublicBuckets))
+	}
+
+	if l := b.Logging; l != nil {
+		body.AppendNewline()
+		lb := codegen.ResourceBlock(body, b.child("aws_s3_bucket_logging"))
+		lb.SetAttributeTraversal("bucket", bucketID)
+		if l.TargetBucket != nil {
+			codegen.SetReference(lb, "target_bucket", stack, *l.TargetBucket)
+		}
+		setString(lb, "target_prefix", l.TargetPrefix)
+	}
+}
+
+func writeLifecycleRule(body *hclwrite.Body, r LifecycleRule) {
+	setString(body, "id", r.ID)
+	body.SetAttributeValue("status", cty.StringVal(string(r.Status)))
+
+	// rules without a filter apply to every object, or the deprecated prefix
+	body.AppendNewline()
+	fb := body.AppendNewBlock("filter", nil).Body()
+	prefix := r.FilterPrefix
+	if prefix == nil {
+		prefix = r.Prefix
+	}
+	switch {
+	case len(r.FilterTags) == 1 && prefix == nil:
+		tb := fb.AppendNewBlock("tag", nil).Body()
+		setString(tb, "key", r.FilterTags[0].Key)
+		setString(tb, "value", r.FilterTags[0].Value)
+	case len(r.FilterTags) > 0:
+		ab := fb.AppendNewBlock("and", nil).Body()
+		setString(ab, "prefix", prefix)
+		tags := map[string]string{}
+		for _, t := range r.FilterTags {
+			tags[str(t.Key)] = str(t.Value)
+		}
+		ab.SetAttributeValue("tags", codegen.StringMap(tags))
+	default:
+		setString(fb, "prefix", prefix)
+	}
+
+	if e := r.Expiration; e != nil {
+		body.AppendNewline()
+		eb := body.AppendNewBlock("expiration", nil).Body()
+		setDays(eb, "days", e.Days)
+		setDate(eb, "date", e.Date)
+		if e.ExpiredObjectDeleteMarker {
+			eb.SetAttributeValue("expired_object_delete_marker", cty.True)
+		}
+	}
+	for _, t := range r.Transitions {
+		body.AppendNewline()
+		tb := body.AppendNewBlock("transition", nil).Body()
+		setDays(tb, "days", t.Days)
+		setDate(tb, "date", t.Date)
+		tb.SetAttributeValue("storage_class", cty.StringVal(string(t.StorageClass)))
+	}
+	if e := r.NoncurrentVersionExpiration; e != nil {
+		body.AppendNewline()
+		eb := body.AppendNewBlock("noncurrent_version_expiration", nil).Body()
+		setDays(eb, "noncurrent_days", e.NoncurrentDays)
+	}
+	for _, t := range r.NoncurrentVersionTransitions {
+		body.AppendNewline()
+		tb := body.AppendNewBlock("noncurrent_version_transition", nil).Body()
+		setDays(tb, "noncurrent_days", t.NoncurrentDays)
+		tb.SetAttributeValue("storage_class", cty.StringVal(string(t.StorageClass)))
+	}
+	if a := r.AbortIncompleteMultipartUpload; a != nil {
+		body.AppendNewline()
+		ab := body.AppendNewBlock("abort_incomplete_multipart_upload", nil).Body()
+		setDays(ab, "days_after_initiation", a.DaysAfterInitiation)
+	}
+}
+
+func writeNotification(body *hclwrite.Body, stack codegen.Stack, id *string, arnName string, arn *string, events []s3Types.Event, filter *s3Types.NotificationConfigurationFilter) {
+	setString(body, "id", id)
+	if arn != nil {
+		codegen.SetReference(body, arnName, stack, *arn)
+	}
+	names := []string{}
+	for _, e := range events {
+		names = append(names, string(e))
+	}
+	body.SetAttributeValue("events", codegen.StringList(names))
+	if filter == nil || filter.Key == nil {
+		return
+	}
+	// s3 returns the names of the rules capitalized, as Prefix and Suffix
+	for _, r := range filter.Key.FilterRules {
+		switch {
+		case strings.EqualFold(string(r.Name), string(s3Types.FilterRuleNamePrefix)):
+			setString(body, "filter_prefix", r.Value)
+		case strings.EqualFold(string(r.Name), string(s3Types.FilterRuleNameSuffix)):
+			setString(body, "filter_suffix", r.Value)
+		}
+	}
+}
+
+func setDays(body *hclwrite.Body, name string, days int32) {
+	if days != 0 {
+		body.SetAttributeValue(name, cty.NumberIntVal(int64(days)))
+	}
+}
+
+func setDate(body *hclwrite.Body, name string, date *time.Time) {
+	if date != nil {
+		body.SetAttributeValue(name, cty.StringVal(date.UTC().Format(time.RFC3339)))
+	}
+}
+
+// BucketPolicy is the policy of a bucket. Its physical id is the name of the
+// bucket.
+type BucketPolicy struct {
+	LogicalID string
+	Bucket    string
+	Policy    string
+}
+
+func (aws *Client) GetBucketPolicy(ctx context.Context, logicalID string, bucketName string) (*BucketPolicy, error) {
+	policy, err := aws.s3.GetBucketPolicy(ctx, &s3.GetBucketPolicyInput{
+		Bucket: &bucketName,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &BucketPolicy{
+		LogicalID: logicalID,
+		Bucket:    bucketName,
+		Policy:    str(policy.Policy),
+	}, nil
+}
+
+func (p BucketPolicy) Resource() types.Resource {
+	return types.Resource{
+		Type:       "aws_s3_bucket_policy",
+		Identifier: p.LogicalID,
+		ImportKey:  p.Bucket,
+		OutputKey:  "id",
+	}
+}
+
+func (p BucketPolicy) WriteHCL(body *hclwrite.Body, stack codegen.Stack) {
+	b := codegen.ResourceBlock(body, p.Resource())
+	codegen.SetReference(b, "bucket", stack, p.Bucket)
+	b.SetAttributeRaw("policy", codegen.JSONEncodeReferences(stack, p.Policy))
+}
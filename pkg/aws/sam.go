@@ -0,0 +1,88 @@
+package aws
+
+import (
+	"strings"
+
+	"github.com/cr-norton/tfconvert/pkg/codegen"
+)
+
+// logGroupPrefix is the prefix of the names of the log groups of functions.
+const logGroupPrefix = "/aws/lambda/"
+
+// functionGroups returns the function each resource belongs to, keyed by
+// logical id. These are the resources SAM generates for an
+// AWS::Serverless::Function, found by their references to the function: the
+// role only it assumes, the event source mappings, subscriptions and
+// permissions invoking it and its log group.
+func (s Stack) functionGroups() map[string]string {
+	groups := map[string]string{}
+	roles := map[string][]string{}
+	names := map[string]string{}
+	for _, f := range s.LambdaFunctions() {
+		groups[f.LogicalID] = f.LogicalID
+		if f.FunctionName != nil {
+			names[*f.FunctionName] = f.LogicalID
+		}
+		if role := s.reference(f.Role, "aws_iam_role"); role != "" {
+			roles[role] = append(roles[role], f.LogicalID)
+		}
+	}
+	for role, functions := range roles {
+		if len(functions) == 1 {
+			groups[role] = functions[0]
+		}
+	}
+
+	for _, e := range s.LambdaEventSources() {
+		if f := s.reference(e.FunctionArn, "aws_lambda_function"); f != "" {
+			groups[e.LogicalID] = f
+		}
+	}
+	for _, t := range s.TopicSubscriptions() {
+		if t.Attributes["Protocol"] != "lambda" {
+			continue
+		}
+		endpoint := t.Attributes["Endpoint"]
+		if f := s.reference(&endpoint, "aws_lambda_function"); f != "" {
+			groups[t.LogicalID] = f
+		}
+	}
+	for _, p := range s.LambdaPermissions() {
+		arn, _ := p.function()
+		if f := s.reference(&arn, "aws_lambda_function"); f != "" {
+			groups[p.LogicalID] = f
+		}
+	}
+	for _, l := range s.LogGroups() {
+		if l.LogGroupName == nil {
+			continue
+		}
+		if f, has := names[strings.TrimPrefix(*l.LogGroupName, logGroupPrefix)]; has && strings.HasPrefix(*l.LogGroupName, logGroupPrefix) {
+			groups[l.LogicalID] = f
+			continue
+		}
+		// the name built by an Fn::Sub of the function name
+		parts := s.Interpolation(*l.LogGroupName)
+		if len(parts) == 2 && parts[0].Literal == logGroupPrefix && parts[1].Resource != nil && parts[1].Resource.Type == "aws_lambda_function" {
+			groups[l.LogicalID] = parts[1].Resource.Identifier
+		}
+	}
+	return groups
+}
+
+// reference returns the logical id of the resource of a terraform type id
+// references, if any.
+func (s Stack) reference(id *string, terraformType string) string {
+	if id == nil {
+		return ""
+	}
+	if res := s.Lookup(*id); res != nil && res.Type == terraformType {
+		return res.Identifier
+	}
+	return ""
+}
+
+// functionFile is the template of the resources grouped with a function.
+func functionFile(logicalID string) string {
+	return "lambda_" + codegen.Name(logicalID) + ".tmpl"
+}
@@ -1,58 +1,291 @@
 package aws
 
-import "github.com/cr-norton/tfconvert/pkg/types"
+import (
+	"sort"
+
+	"github.com/cr-norton/tfconvert/pkg/codegen"
+	"github.com/cr-norton/tfconvert/pkg/types"
+	"github.com/pkg/errors"
+)
 
 type Stack struct {
 	Name           string
 	ServiceName    string
 	AdditionalTags map[string]string
 	Index          map[string]types.Resource
+	Failures       []Failure
+	Parameters     []Parameter
+	Outputs        []Output
+	// StackID is the arn of the stack
+	StackID string
+	// Template is the processed template the stack was deployed with
+	Template string
+	// Flattened are the nested stacks converted into this one
+	Flattened []FlattenedStack
+	// Exports are the values of other stacks imported by the stack
+	Exports          []Export
+	ExportReferences ExportReferences
+	// Nested are the nested stacks when they are converted as modules
+	Nested []*Stack
+	// GroupFunctions writes every function to a file of its own along with
+	// the resources generated for it
+	GroupFunctions bool
 	*StackResources
+
+	interpolations   map[string][]codegen.InterpolationPart
+	pseudoParameters map[string]bool
+	// numbers are the placeholders of numeric template properties set from
+	// references, keyed by the path of the property
+	numbers map[string]string
+
+	// batch resolves references to the other stacks converted with this one
+	batch *Batch
+}
+
+// FlattenedStack is a nested stack converted into its parent, the logical ids
+// of its resources prefixed with Prefix. Its template resolves the references
+// between its resources.
+type FlattenedStack struct {
+	Prefix     string      `json:"prefix"`
+	Name       string      `json:"name"`
+	StackID    string      `json:"stack_id"`
+	Template   string      `json:"template"`
+	Parameters []Parameter `json:"parameters,omitempty"`
+}
+
+// Failure is a resource that couldn't be fetched when continuing on errors.
+type Failure struct {
+	ResourceType string `json:"resource_type"`
+	LogicalID    string `json:"logical_id"`
+	PhysicalID   string `json:"physical_id"`
+	Error        string `json:"error"`
+}
+
+// Stacks returns the stack followed by its nested stacks, depth first.
+func (s *Stack) Stacks() []*Stack {
+	stacks := []*Stack{s}
+	for _, n := range s.Nested {
+		stacks = append(stacks, n.Stacks()...)
+	}
+	return stacks
+}
+
+// NumberReference returns the placeholder a numeric property of a template
+// file was set from, such as ${MemorySize} for a parameter.
+func (s Stack) NumberReference(property string) (string, bool) {
+	p, has := s.numbers[property]
+	return p, has
 }
 
 func (s Stack) Lookup(id string) *types.Resource {
 	if r, has := s.Index[id]; has {
 		return &r
 	}
+	if s.batch != nil {
+		if r := s.batch.lookup(s, id); r != nil {
+			return r
+		}
+	}
+	for _, e := range s.Exports {
+		if e.Value == id {
+			return s.ExportReferences.reference(e)
+		}
+	}
 	return nil
 }
 
+// Tags returns the tags applied to every generated resource.
+func (s Stack) Tags() map[string]string {
+	tags := map[string]string{"Service": s.ServiceName}
+	for k, v := range s.AdditionalTags {
+		tags[k] = v
+	}
+	return tags
+}
+
+// Resources returns the terraform resources generated for the stack, including
+// child resources such as inline role policies.
 func (s Stack) Resources() []types.Resource {
 	resources := []types.Resource{}
-	for _, res := range s.Index {
-		resources = append(resources, res)
+	for _, rs := range s.ByType {
+		for _, r := range rs {
+			resources = append(resources, r.Resource())
+			if c, ok := r.(parent); ok {
+				resources = append(resources, c.ChildResources()...)
+			}
+		}
 	}
+	sort.Slice(resources, func(i, j int) bool {
+		if resources[i].Type != resources[j].Type {
+			return resources[i].Type < resources[j].Type
+		}
+		return resources[i].Identifier < resources[j].Identifier
+	})
 	return resources
 }
 
+// StackResources holds the fetched resources keyed by CloudFormation type.
 type StackResources struct {
-	DynamoTables            []DynamoTable
-	Roles                   []Role
-	FirehoseDeliveryStreams []FirehoseDeliveryStream
-	LambdaFunctions         []LambdaFunctionConfiguration
-	LambdaEventSources      []LambdaEventSource
-	LogGroups               []LogGroup
-	Queues                  []Queue
-	Topics                  []Topic
-	TopicSubscriptions      []TopicSubscription
+	ByType map[string][]StackResource
 }
 
-func index(stack *StackResources) map[string]types.Resource {
-	index := map[string]types.Resource{}
-	for _, r := range stack.DynamoTables {
-		index[r.Key()] = r.Resource()
+// add stores a resource fetched by a handler, checking the resource is
+// addressed as the terraform type the handler generates.
+func (s *StackResources) add(h ResourceHandler, r StackResource) error {
+	if res := r.Resource(); res.Type != h.TerraformType() {
+		return errors.Errorf("%s handler fetched %s resource %s, expected %s", h.ResourceType(), res.Type, res.Identifier, h.TerraformType())
+	}
+	s.ByType[h.ResourceType()] = append(s.ByType[h.ResourceType()], r)
+	return nil
+}
+
+// Get returns the resources of a CloudFormation type, for use by templates of
+// handlers registered outside this package.
+func (s *StackResources) Get(resourceType string) []StackResource {
+	return s.ByType[resourceType]
+}
+
+func (s *StackResources) RestApis() []RestApi {
+	apis := []RestApi{}
+	for _, r := range s.ByType["AWS::ApiGateway::RestApi"] {
+		apis = append(apis, r.(RestApi))
+	}
+	return apis
+}
+
+func (s *StackResources) ApisV2() []ApiV2 {
+	apis := []ApiV2{}
+	for _, r := range s.ByType["AWS::ApiGatewayV2::Api"] {
+		apis = append(apis, r.(ApiV2))
 	}
-	for _, r := range stack.Roles {
-		index[r.Key()] = r.Resource()
+	return apis
+}
+
+func (s *StackResources) Buckets() []Bucket {
+	buckets := []Bucket{}
+	for _, r := range s.ByType["AWS::S3::Bucket"] {
+		buckets = append(buckets, r.(Bucket))
 	}
-	for _, r := range stack.LambdaFunctions {
-		index[r.Key()] = r.Resource()
+	return buckets
+}
+
+func (s *StackResources) BucketPolicies() []BucketPolicy {
+	policies := []BucketPolicy{}
+	for _, r := range s.ByType["AWS::S3::BucketPolicy"] {
+		policies = append(policies, r.(BucketPolicy))
 	}
-	for _, r := range stack.Queues {
-		index[r.Key()] = r.Resource()
+	return policies
+}
+
+func (s *StackResources) LambdaPermissions() []LambdaPermission {
+	permissions := []LambdaPermission{}
+	for _, r := range s.ByType["AWS::Lambda::Permission"] {
+		permissions = append(permissions, r.(LambdaPermission))
 	}
-	for _, r := range stack.Topics {
-		index[r.Key()] = r.Resource()
+	return permissions
+}
+
+func (s *StackResources) LambdaAliases() []LambdaAlias {
+	aliases := []LambdaAlias{}
+	for _, r := range s.ByType["AWS::Lambda::Alias"] {
+		aliases = append(aliases, r.(LambdaAlias))
+	}
+	return aliases
+}
+
+func (s *StackResources) LambdaLayerVersions() []LambdaLayerVersion {
+	layers := []LambdaLayerVersion{}
+	for _, r := range s.ByType["AWS::Lambda::LayerVersion"] {
+		layers = append(layers, r.(LambdaLayerVersion))
+	}
+	return layers
+}
+
+func (s *StackResources) DynamoTables() []DynamoTable {
+	tables := []DynamoTable{}
+	for _, r := range s.ByType["AWS::DynamoDB::Table"] {
+		tables = append(tables, r.(DynamoTable))
+	}
+	return tables
+}
+
+func (s *StackResources) Roles() []Role {
+	roles := []Role{}
+	for _, r := range s.ByType["AWS::IAM::Role"] {
+		roles = append(roles, r.(Role))
+	}
+	return roles
+}
+
+func (s *StackResources) FirehoseDeliveryStreams() []FirehoseDeliveryStream {
+	streams := []FirehoseDeliveryStream{}
+	for _, r := range s.ByType["AWS::KinesisFirehose::DeliveryStream"] {
+		streams = append(streams, r.(FirehoseDeliveryStream))
+	}
+	return streams
+}
+
+func (s *StackResources) LambdaFunctions() []LambdaFunctionConfiguration {
+	functions := []LambdaFunctionConfiguration{}
+	for _, r := range s.ByType["AWS::Lambda::Function"] {
+		functions = append(functions, r.(LambdaFunctionConfiguration))
+	}
+	return functions
+}
+
+func (s *StackResources) LambdaEventSources() []LambdaEventSource {
+	events := []LambdaEventSource{}
+	for _, r := range s.ByType["AWS::Lambda::EventSourceMapping"] {
+		events = append(events, r.(LambdaEventSource))
+	}
+	return events
+}
+
+func (s *StackResources) LogGroups() []LogGroup {
+	groups := []LogGroup{}
+	for _, r := range s.ByType["AWS::Logs::LogGroup"] {
+		groups = append(groups, r.(LogGroup))
+	}
+	return groups
+}
+
+func (s *StackResources) Queues() []Queue {
+	queues := []Queue{}
+	for _, r := range s.ByType["AWS::SQS::Queue"] {
+		queues = append(queues, r.(Queue))
+	}
+	return queues
+}
+
+func (s *StackResources) Topics() []Topic {
+	topics := []Topic{}
+	for _, r := range s.ByType["AWS::SNS::Topic"] {
+		topics = append(topics, r.(Topic))
+	}
+	return topics
+}
+
+func (s *StackResources) TopicSubscriptions() []TopicSubscription {
+	subscriptions := []TopicSubscription{}
+	for _, r := range s.ByType["AWS::SNS::Subscription"] {
+		subscriptions = append(subscriptions, r.(TopicSubscription))
+	}
+	return subscriptions
+}
+
+func index(stack *StackResources) map[string]types.Resource {
+	index := map[string]types.Resource{}
+	for _, resources := range stack.ByType {
+		for _, r := range resources {
+			if k, ok := r.(keyed); ok {
+				index[k.Key()] = r.Resource()
+			}
+			if k, ok := r.(multiKeyed); ok {
+				for key, res := range k.Keys() {
+					index[key] = res
+				}
+			}
+		}
 	}
 	return index
 }
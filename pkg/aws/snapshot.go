@@ -0,0 +1,114 @@
+package aws
+
+import (
+	"encoding/json"
+
+	"github.com/cr-norton/tfconvert/pkg/types"
+	"github.com/pkg/errors"
+)
+
+// SnapshotVersion is the version of the snapshot schema written by MarshalSnapshot.
+const SnapshotVersion = 1
+
+// Snapshot is the serialized form of a Stack, used to generate terraform
+// without calling aws.
+type Snapshot struct {
+	Version        int                       `json:"version"`
+	Name           string                    `json:"name"`
+	ServiceName    string                    `json:"service_name"`
+	AdditionalTags map[string]string         `json:"additional_tags"`
+	Index          map[string]types.Resource `json:"index"`
+	StackID        string                    `json:"stack_id,omitempty"`
+	Template       string                    `json:"template,omitempty"`
+	Flattened      []FlattenedStack          `json:"flattened,omitempty"`
+	Parameters     []Parameter               `json:"parameters,omitempty"`
+	Outputs        []Output                  `json:"outputs,omitempty"`
+	Exports        []Export                  `json:"exports,omitempty"`
+	Resources      []SnapshotResource        `json:"resources"`
+}
+
+// SnapshotResource is a fetched resource tagged with its CloudFormation type.
+type SnapshotResource struct {
+	ResourceType string          `json:"resource_type"`
+	Resource     json.RawMessage `json:"resource"`
+}
+
+// MarshalSnapshot serializes the stack as a versioned snapshot.
+func MarshalSnapshot(stack Stack) ([]byte, error) {
+	snapshot := Snapshot{
+		Version:        SnapshotVersion,
+		Name:           stack.Name,
+		ServiceName:    stack.ServiceName,
+		AdditionalTags: stack.AdditionalTags,
+		Index:          stack.Index,
+		StackID:        stack.StackID,
+		Template:       stack.Template,
+		Flattened:      stack.Flattened,
+		Parameters:     stack.Parameters,
+		Outputs:        stack.Outputs,
+		Exports:        stack.Exports,
+		Resources:      []SnapshotResource{},
+	}
+	for _, h := range Handlers() {
+		for _, r := range stack.Get(h.ResourceType()) {
+			bytes, err := json.Marshal(r)
+			if err != nil {
+				return nil, errors.Wrapf(err, "unable to marshal %s", h.ResourceType())
+			}
+			snapshot.Resources = append(snapshot.Resources, SnapshotResource{
+				ResourceType: h.ResourceType(),
+				Resource:     bytes,
+			})
+		}
+	}
+	return json.MarshalIndent(snapshot, "", "  ")
+}
+
+// UnmarshalSnapshot deserializes a snapshot written by MarshalSnapshot. The
+// index is rebuilt from the resources so it always matches their handlers.
+func UnmarshalSnapshot(bytes []byte) (*Stack, error) {
+	var snapshot Snapshot
+	if err := json.Unmarshal(bytes, &snapshot); err != nil {
+		return nil, errors.Wrap(err, "unable to parse snapshot")
+	}
+	if snapshot.Version != SnapshotVersion {
+		return nil, errors.Errorf("unsupported snapshot version %d, expected %d", snapshot.Version, SnapshotVersion)
+	}
+
+	stackres := &StackResources{ByType: map[string][]StackResource{}}
+	for _, sr := range snapshot.Resources {
+		h, has := Handler(sr.ResourceType)
+		if !has {
+			return nil, errors.Errorf("no handler registered for snapshot resource %s", sr.ResourceType)
+		}
+		r, err := h.Decode(sr.Resource)
+		if err != nil {
+			return nil, errors.Wrapf(err, "unable to decode %s", sr.ResourceType)
+		}
+		if err := stackres.add(h, r); err != nil {
+			return nil, err
+		}
+	}
+
+	if snapshot.AdditionalTags == nil {
+		snapshot.AdditionalTags = map[string]string{}
+	}
+
+	stack := &Stack{
+		Name:           snapshot.Name,
+		ServiceName:    snapshot.ServiceName,
+		AdditionalTags: snapshot.AdditionalTags,
+		Index:          index(stackres),
+		StackID:        snapshot.StackID,
+		Template:       snapshot.Template,
+		Flattened:      snapshot.Flattened,
+		Parameters:     snapshot.Parameters,
+		Outputs:        snapshot.Outputs,
+		Exports:        snapshot.Exports,
+		StackResources: stackres,
+	}
+	if err := stack.applyTemplate(); err != nil {
+		return nil, err
+	}
+	return stack, nil
+}
@@ -0,0 +1,487 @@
+package aws
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	apigatewayTypes "github.com/aws/aws-sdk-go-v2/service/apigateway/types"
+	dynamodb "github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/cr-norton/tfconvert/pkg/codegen"
+	"github.com/cr-norton/tfconvert/pkg/types"
+)
+
+// StateResources returns the resources that can be written straight to
+// terraform state, in stack order, each followed by its children.
+func (s Stack) StateResources() []codegen.StateResource {
+	resources := []codegen.StateResource{}
+	for _, h := range Handlers() {
+		for _, r := range s.Get(h.ResourceType()) {
+			if sr, ok := r.(codegen.StateResource); ok {
+				resources = append(resources, sr)
+			}
+			if p, ok := r.(stateParent); ok {
+				resources = append(resources, p.ChildStateResources()...)
+			}
+		}
+	}
+	return resources
+}
+
+// stateParent is implemented by resources whose child resources can be
+// written straight to terraform state.
+type stateParent interface {
+	ChildStateResources() []codegen.StateResource
+}
+
+// childState is a child resource written to state with the attributes its
+// parent holds, which are enough for the provider to read it.
+type childState struct {
+	resource   types.Resource
+	attributes attributes
+}
+
+func (c childState) Resource() types.Resource { return c.resource }
+
+func (c childState) SchemaVersion() int { return 0 }
+
+func (c childState) StateAttributes() map[string]interface{} { return c.attributes }
+
+type attributes map[string]interface{}
+
+func (a attributes) setString(name string, s *string) {
+	if s != nil {
+		a[name] = *s
+	}
+}
+
+func (a attributes) setInt64(name string, i *int64) {
+	if i != nil {
+		a[name] = *i
+	}
+}
+
+func (a attributes) setInt32(name string, i *int32) {
+	if i != nil {
+		a[name] = *i
+	}
+}
+
+func (a attributes) setTime(name string, t *time.Time) {
+	if t != nil {
+		a[name] = t.UTC().Format(time.RFC3339)
+	}
+}
+
+// setAttribute copies a numeric aws attribute, dropping values that don't parse.
+func (a attributes) setAttribute(name string, attrs map[string]string, key string) {
+	if v, has := attrs[key]; has {
+		if i, err := strconv.ParseInt(v, 10, 64); err == nil {
+			a[name] = i
+		}
+	}
+}
+
+func (d DynamoTable) SchemaVersion() int { return 1 }
+
+func (d DynamoTable) StateAttributes() map[string]interface{} {
+	a := attributes{}
+	a.setString("id", d.TableName)
+	a.setString("name", d.TableName)
+	a.setString("arn", d.TableArn)
+	a.setString("hash_key", keySchemaElement(d.KeySchema, dynamodb.KeyTypeHash))
+	a.setString("range_key", keySchemaElement(d.KeySchema, dynamodb.KeyTypeRange))
+	a.setString("stream_arn", d.LatestStreamArn)
+	a["billing_mode"] = string(dynamodb.BillingModeProvisioned)
+	if d.BillingModeSummary != nil && d.BillingModeSummary.BillingMode != "" {
+		a["billing_mode"] = string(d.BillingModeSummary.BillingMode)
+	}
+	if d.ProvisionedThroughput != nil {
+		a.setInt64("read_capacity", d.ProvisionedThroughput.ReadCapacityUnits)
+		a.setInt64("write_capacity", d.ProvisionedThroughput.WriteCapacityUnits)
+	}
+	return a
+}
+
+func (r Role) SchemaVersion() int { return 0 }
+
+func (r Role) StateAttributes() map[string]interface{} {
+	a := attributes{}
+	a.setString("id", r.RoleName)
+	a.setString("name", r.RoleName)
+	a.setString("arn", r.Role.Arn)
+	a.setString("unique_id", r.RoleId)
+	a.setString("path", r.Path)
+	a.setString("description", r.Description)
+	a.setInt32("max_session_duration", r.MaxSessionDuration)
+	a.setTime("create_date", r.CreateDate)
+	if r.AssumeRolePolicyDocument != nil {
+		a["assume_role_policy"] = decodePolicyDocument(*r.AssumeRolePolicyDocument)
+	}
+	return a
+}
+
+func (r Role) ChildStateResources() []codegen.StateResource {
+	resources := []codegen.StateResource{}
+	for _, p := range r.inlinePolicies() {
+		resources = append(resources, childState{p.Resource, attributes{
+			"id":     p.ImportKey,
+			"role":   *r.RoleName,
+			"name":   p.Name,
+			"policy": decodePolicyDocument(r.PolicyDocuments[p.Name]),
+		}})
+	}
+	for _, a := range r.policyAttachments() {
+		resources = append(resources, childState{a.Resource, attributes{
+			// the id terraform import gives attachments
+			"id":         *r.RoleName + "-" + a.PolicyArn,
+			"role":       *r.RoleName,
+			"policy_arn": a.PolicyArn,
+		}})
+	}
+	return resources
+}
+
+func (f FirehoseDeliveryStream) SchemaVersion() int { return 1 }
+
+func (f FirehoseDeliveryStream) StateAttributes() map[string]interface{} {
+	a := attributes{}
+	a.setString("id", f.DeliveryStreamARN)
+	a.setString("arn", f.DeliveryStreamARN)
+	a.setString("name", f.DeliveryStreamName)
+	a.setString("version_id", f.VersionId)
+	a["destination"] = "extended_s3"
+	return a
+}
+
+func (l LambdaFunctionConfiguration) SchemaVersion() int { return 0 }
+
+func (l LambdaFunctionConfiguration) StateAttributes() map[string]interface{} {
+	a := attributes{}
+	a.setString("id", l.FunctionName)
+	a.setString("function_name", l.FunctionName)
+	a.setString("arn", l.FunctionArn)
+	a.setString("role", l.Role)
+	a.setString("handler", l.Handler)
+	a.setString("description", l.Description)
+	a.setString("version", l.Version)
+	a.setString("last_modified", l.LastModified)
+	a.setString("source_code_hash", l.CodeSha256)
+	a.setInt32("memory_size", l.MemorySize)
+	a.setInt32("timeout", l.Timeout)
+	a["source_code_size"] = l.CodeSize
+	if l.Runtime != "" {
+		a["runtime"] = string(l.Runtime)
+	}
+	if l.PackageType != "" {
+		a["package_type"] = string(l.PackageType)
+	}
+	return a
+}
+
+func (l LambdaFunctionConfiguration) ChildStateResources() []codegen.StateResource {
+	resources := []codegen.StateResource{}
+	for _, v := range l.Versions {
+		if v.ProvisionedConcurrency != nil {
+			resources = append(resources, provisionedConcurrencyState(v.provisionedConcurrency(), v.Version, v.ProvisionedConcurrency))
+		}
+	}
+	return resources
+}
+
+// provisionedConcurrencyState is the state of the provisioned concurrency of
+// a version or alias, whose import key is the function and qualifier.
+func provisionedConcurrencyState(res types.Resource, qualifier string, concurrency *int32) codegen.StateResource {
+	a := attributes{
+		"id":            res.ImportKey,
+		"function_name": strings.TrimSuffix(res.ImportKey, ":"+qualifier),
+		"qualifier":     qualifier,
+	}
+	a.setInt32("provisioned_concurrent_executions", concurrency)
+	return childState{res, a}
+}
+
+func (l LambdaEventSource) SchemaVersion() int { return 0 }
+
+func (l LambdaEventSource) StateAttributes() map[string]interface{} {
+	a := attributes{}
+	a.setString("id", l.UUID)
+	a.setString("uuid", l.UUID)
+	a.setString("event_source_arn", l.EventSourceArn)
+	a.setString("function_arn", l.FunctionArn)
+	a.setString("state", l.State)
+	a.setInt32("batch_size", l.BatchSize)
+	return a
+}
+
+func (a LambdaAlias) SchemaVersion() int { return 0 }
+
+func (a LambdaAlias) StateAttributes() map[string]interface{} {
+	attrs := attributes{
+		"function_name": functionName(a.function()),
+	}
+	attrs.setString("id", a.AliasArn)
+	attrs.setString("arn", a.AliasArn)
+	attrs.setString("name", a.Name)
+	attrs.setString("description", a.Description)
+	attrs.setString("function_version", a.FunctionVersion)
+	return attrs
+}
+
+func (a LambdaAlias) ChildStateResources() []codegen.StateResource {
+	if a.ProvisionedConcurrency == nil {
+		return nil
+	}
+	return []codegen.StateResource{provisionedConcurrencyState(a.provisionedConcurrency(), *a.Name, a.ProvisionedConcurrency)}
+}
+
+func (p LambdaPermission) SchemaVersion() int { return 0 }
+
+func (p LambdaPermission) StateAttributes() map[string]interface{} {
+	arn, qualifier := p.function()
+	a := attributes{
+		"id":            p.StatementID,
+		"statement_id":  p.StatementID,
+		"action":        p.Action,
+		"principal":     p.Principal,
+		"function_name": functionName(arn),
+	}
+	if qualifier != "" {
+		a["qualifier"] = qualifier
+	}
+	a.setString("source_arn", p.SourceArn)
+	a.setString("source_account", p.SourceAccount)
+	a.setString("event_source_token", p.EventSourceToken)
+	return a
+}
+
+func (l LambdaLayerVersion) SchemaVersion() int { return 0 }
+
+func (l LambdaLayerVersion) StateAttributes() map[string]interface{} {
+	a := attributes{
+		"id":         l.LayerVersionArn,
+		"arn":        l.LayerVersionArn,
+		"layer_arn":  l.LayerArn,
+		"layer_name": functionName(l.LayerArn),
+		"version":    functionName(l.LayerVersionArn),
+	}
+	a.setString("description", l.Description)
+	a.setString("license_info", l.LicenseInfo)
+	return a
+}
+
+func (l LogGroup) SchemaVersion() int { return 0 }
+
+func (l LogGroup) StateAttributes() map[string]interface{} {
+	a := attributes{}
+	a.setString("id", l.LogGroupName)
+	a.setString("name", l.LogGroupName)
+	a.setString("kms_key_id", l.KmsKeyId)
+	if l.Arn != nil {
+		a["arn"] = strings.TrimSuffix(*l.Arn, ":*")
+	}
+	a["retention_in_days"] = 0
+	a.setInt32("retention_in_days", l.RetentionInDays)
+	return a
+}
+
+func (q Queue) SchemaVersion() int { return 0 }
+
+func (q Queue) StateAttributes() map[string]interface{} {
+	a := attributes{
+		"id":   q.QueueUrl(),
+		"url":  q.QueueUrl(),
+		"name": q.QueueName(),
+		"arn":  q.Attributes["QueueArn"],
+	}
+	a.setAttribute("delay_seconds", q.Attributes, "DelaySeconds")
+	a.setAttribute("max_message_size", q.Attributes, "MaximumMessageSize")
+	a.setAttribute("message_retention_seconds", q.Attributes, "MessageRetentionPeriod")
+	a.setAttribute("receive_wait_time_seconds", q.Attributes, "ReceiveMessageWaitTimeSeconds")
+	a.setAttribute("visibility_timeout_seconds", q.Attributes, "VisibilityTimeout")
+	a["fifo_queue"] = q.Attributes["FifoQueue"] == "true"
+	return a
+}
+
+func (t Topic) SchemaVersion() int { return 0 }
+
+func (t Topic) StateAttributes() map[string]interface{} {
+	a := attributes{
+		"id":   t.Attributes["TopicArn"],
+		"arn":  t.Attributes["TopicArn"],
+		"name": t.TopicName(),
+	}
+	if name, has := t.Attributes["DisplayName"]; has {
+		a["display_name"] = name
+	}
+	return a
+}
+
+func (t TopicSubscription) SchemaVersion() int { return 0 }
+
+func (t TopicSubscription) StateAttributes() map[string]interface{} {
+	return attributes{
+		"id":        t.Attributes["SubscriptionArn"],
+		"arn":       t.Attributes["SubscriptionArn"],
+		"topic_arn": t.Attributes["TopicArn"],
+		"protocol":  t.Attributes["Protocol"],
+		"endpoint":  t.Attributes["Endpoint"],
+	}
+}
+
+func (b Bucket) SchemaVersion() int { return 0 }
+
+func (b Bucket) StateAttributes() map[string]interface{} {
+	return attributes{
+		"id":     b.Name,
+		"bucket": b.Name,
+		"arn":    b.arn(),
+	}
+}
+
+// ChildStateResources returns the configured parts of the bucket, read by
+// the provider from the name of the bucket alone.
+func (b Bucket) ChildStateResources() []codegen.StateResource {
+	resources := []codegen.StateResource{}
+	for _, res := range b.ChildResources() {
+		resources = append(resources, childState{res, attributes{
+			"id":     b.Name,
+			"bucket": b.Name,
+		}})
+	}
+	return resources
+}
+
+func (p BucketPolicy) SchemaVersion() int { return 0 }
+
+func (p BucketPolicy) StateAttributes() map[string]interface{} {
+	return attributes{
+		"id":     p.Bucket,
+		"bucket": p.Bucket,
+		"policy": p.Policy,
+	}
+}
+
+func (a RestApi) SchemaVersion() int { return 0 }
+
+func (a RestApi) StateAttributes() map[string]interface{} {
+	attrs := attributes{}
+	attrs.setString("id", a.Id)
+	attrs.setString("name", a.Name)
+	attrs.setString("description", a.Description)
+	if root := a.rootResource(); root != nil {
+		attrs.setString("root_resource_id", root.Id)
+	}
+	return attrs
+}
+
+// ChildStateResources returns the children of the api with the ids the
+// provider gives them, such as agm-api-resource-GET for a method.
+func (a RestApi) ChildStateResources() []codegen.StateResource {
+	resources := []codegen.StateResource{}
+	for _, r := range a.Resources {
+		if str(r.Path) != "/" {
+			attrs := attributes{"rest_api_id": *a.Id}
+			attrs.setString("id", r.Id)
+			attrs.setString("parent_id", r.ParentId)
+			attrs.setString("path_part", r.PathPart)
+			attrs.setString("path", r.Path)
+			resources = append(resources, childState{a.resource(r), attrs})
+		}
+		for _, httpMethod := range a.httpMethods(r) {
+			m := r.ResourceMethods[httpMethod]
+			suffix := fmt.Sprintf("%s-%s-%s", *a.Id, *r.Id, httpMethod)
+			method := a.methodState("agm-"+suffix, r, httpMethod)
+			method.setString("authorization", m.AuthorizationType)
+			resources = append(resources, childState{a.method(r, httpMethod), method})
+			for _, statusCode := range methodStatusCodes(m) {
+				response := a.methodState("agmr-"+suffix+"-"+statusCode, r, httpMethod)
+				response["status_code"] = statusCode
+				resources = append(resources, childState{a.methodResponse(r, httpMethod, statusCode), response})
+			}
+			if m.MethodIntegration == nil {
+				continue
+			}
+			integration := a.methodState("agi-"+suffix, r, httpMethod)
+			integration["type"] = string(m.MethodIntegration.Type)
+			resources = append(resources, childState{a.integration(r, httpMethod), integration})
+			for _, statusCode := range integrationStatusCodes(m.MethodIntegration) {
+				response := a.methodState("agir-"+suffix+"-"+statusCode, r, httpMethod)
+				response["status_code"] = statusCode
+				resources = append(resources, childState{a.integrationResponse(r, httpMethod, statusCode), response})
+			}
+		}
+	}
+	for _, auth := range a.Authorizers {
+		attrs := attributes{"rest_api_id": *a.Id}
+		attrs.setString("id", auth.Id)
+		attrs.setString("name", auth.Name)
+		resources = append(resources, childState{a.authorizer(auth), attrs})
+	}
+	for _, d := range a.Deployments {
+		attrs := attributes{"rest_api_id": *a.Id}
+		attrs.setString("id", d.Id)
+		attrs.setString("description", d.Description)
+		resources = append(resources, childState{a.deployment(d), attrs})
+	}
+	for _, s := range a.Stages {
+		attrs := attributes{
+			"id":          fmt.Sprintf("ags-%s-%s", *a.Id, str(s.StageName)),
+			"rest_api_id": *a.Id,
+		}
+		attrs.setString("stage_name", s.StageName)
+		attrs.setString("deployment_id", s.DeploymentId)
+		resources = append(resources, childState{a.stage(s), attrs})
+	}
+	return resources
+}
+
+// methodState returns the attributes identifying a method, or its
+// integration or a response of either.
+func (a RestApi) methodState(id string, r apigatewayTypes.Resource, httpMethod string) attributes {
+	return attributes{
+		"id":          id,
+		"rest_api_id": *a.Id,
+		"resource_id": *r.Id,
+		"http_method": httpMethod,
+	}
+}
+
+func (a ApiV2) SchemaVersion() int { return 0 }
+
+func (a ApiV2) StateAttributes() map[string]interface{} {
+	attrs := attributes{
+		"protocol_type": string(a.ProtocolType),
+	}
+	attrs.setString("id", a.ApiId)
+	attrs.setString("name", a.Name)
+	attrs.setString("description", a.Description)
+	attrs.setString("api_endpoint", a.ApiEndpoint)
+	return attrs
+}
+
+func (a ApiV2) ChildStateResources() []codegen.StateResource {
+	resources := []codegen.StateResource{}
+	for _, i := range a.Integrations {
+		attrs := attributes{
+			"api_id":           *a.ApiId,
+			"integration_type": string(i.IntegrationType),
+		}
+		attrs.setString("id", i.IntegrationId)
+		resources = append(resources, childState{a.integration(i), attrs})
+	}
+	for _, r := range a.Routes {
+		attrs := attributes{"api_id": *a.ApiId}
+		attrs.setString("id", r.RouteId)
+		attrs.setString("route_key", r.RouteKey)
+		resources = append(resources, childState{a.route(r), attrs})
+	}
+	for _, s := range a.Stages {
+		attrs := attributes{"api_id": *a.ApiId}
+		attrs.setString("id", s.StageName)
+		attrs.setString("name", s.StageName)
+		resources = append(resources, childState{a.stage(s), attrs})
+	}
+	return resources
+}
@@ -0,0 +1,404 @@
+package aws
+
+import (
+	"context"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/aws/aws-sdk-go-v2/service/cloudformation"
+	cloudformationTypes "github.com/aws/aws-sdk-go-v2/service/cloudformation/types"
+	"github.com/cr-norton/tfconvert/pkg/cfn"
+	"github.com/cr-norton/tfconvert/pkg/codegen"
+	"github.com/cr-norton/tfconvert/pkg/types"
+	"github.com/hashicorp/hcl/v2/hclwrite"
+	"github.com/pkg/errors"
+)
+
+// ReturnValue is the value a Ref or Fn::GetAtt of a resource returns, and the
+// terraform attribute holding it.
+type ReturnValue struct {
+	Name  string
+	Value string
+}
+
+// returning resources resolve Ref, keyed "Ref", and the attributes of Fn::GetAtt
+type returning interface {
+	ReturnValues() map[string]ReturnValue
+}
+
+// GetTemplate returns the processed template of a stack, with transforms
+// such as AWS::Serverless expanded.
+func (aws *Client) GetTemplate(ctx context.Context, stackName string) (string, error) {
+	res, err := aws.cloudformation.GetTemplate(ctx, &cloudformation.GetTemplateInput{
+		StackName:     &stackName,
+		TemplateStage: cloudformationTypes.TemplateStageProcessed,
+	})
+	if err != nil {
+		return "", errors.Wrapf(err, "unable to get template of %s", stackName)
+	}
+	if res.TemplateBody == nil {
+		return "", nil
+	}
+	return *res.TemplateBody, nil
+}
+
+// Interpolation returns how a value was built by an Fn::Sub of the template.
+func (s Stack) Interpolation(value string) []codegen.InterpolationPart {
+	return s.interpolations[value]
+}
+
+// templateScope is the template references are resolved in. Parameters of
+// flattened stacks are passed by their parent rather than being variables, so
+// they resolve to their value.
+type templateScope struct {
+	prefix     string
+	stackName  string
+	parameters []Parameter
+	flattened  bool
+}
+
+// applyTemplate reconstructs references from the intrinsic functions of the
+// template and the templates of flattened stacks. The value every Ref and
+// Fn::GetAtt resolves to is indexed, so lookup references it even when it
+// isn't an arn, and the strings built by Fn::Sub are kept as interpolations.
+func (s *Stack) applyTemplate() error {
+	s.interpolations = map[string][]codegen.InterpolationPart{}
+	s.pseudoParameters = map[string]bool{}
+	if err := s.applyScope(s.Template, templateScope{stackName: s.Name, parameters: s.Parameters}); err != nil {
+		return err
+	}
+	for _, f := range s.Flattened {
+		scope := templateScope{prefix: f.Prefix, stackName: f.Name, parameters: f.Parameters, flattened: true}
+		if err := s.applyScope(f.Template, scope); err != nil {
+			return errors.Wrapf(err, "unable to apply template of nested stack %s", strings.TrimSuffix(f.Prefix, "_"))
+		}
+	}
+	return nil
+}
+
+func (s *Stack) applyScope(template string, scope templateScope) error {
+	if template == "" {
+		return nil
+	}
+	t, err := cfn.Parse([]byte(template))
+	if err != nil {
+		return err
+	}
+
+	values := []interface{}{}
+	for _, id := range t.LogicalIDs() {
+		values = append(values, t.Resources[id].Properties)
+	}
+	names := []string{}
+	for name := range t.Outputs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		values = append(values, t.Outputs[name].Value)
+	}
+
+	for _, v := range values {
+		cfn.Walk(v, func(v interface{}) {
+			if id, ok := cfn.Ref(v); ok {
+				if value, res, ok := s.resolve(scope, id, "Ref"); ok && res != nil {
+					s.addIndex(value, *res)
+				}
+			} else if id, attribute, ok := cfn.GetAtt(v); ok {
+				if value, res, ok := s.resolve(scope, id, attribute); ok && res != nil {
+					s.addIndex(value, *res)
+				}
+			} else if format, vars, ok := cfn.Sub(v); ok {
+				s.addInterpolation(scope, format, vars)
+			}
+		})
+	}
+	return nil
+}
+
+// addIndex indexes the value a reference resolves to. Pseudo parameters such
+// as the partition "aws", the region or the account id are common parts of
+// unrelated literals, so they are only referenced within interpolations.
+func (s *Stack) addIndex(value string, res types.Resource) {
+	if strings.HasPrefix(res.Type, "data.") {
+		return
+	}
+	if res.Type == "var" && !indexable(value) {
+		return
+	}
+	if _, has := s.Index[value]; !has {
+		s.Index[value] = res
+	}
+}
+
+// indexable reports whether a parameter value is distinctive enough to
+// reference the parameter wherever it appears. Short values, booleans,
+// numbers and wildcards like "*" appear in unrelated properties, and are left
+// as literals.
+func indexable(value string) bool {
+	if len(value) < 3 || value == "true" || value == "false" {
+		return false
+	}
+	if _, err := strconv.ParseFloat(value, 64); err == nil {
+		return false
+	}
+	for _, c := range value {
+		if unicode.IsLetter(c) {
+			return true
+		}
+	}
+	return false
+}
+
+// addInterpolation resolves the variables of an Fn::Sub. Strings with a
+// variable that can't be resolved are skipped.
+func (s *Stack) addInterpolation(scope templateScope, format string, vars map[string]interface{}) {
+	parts := []codegen.InterpolationPart{}
+	value := ""
+	references := 0
+	for _, p := range cfn.SubParts(format) {
+		if p.Variable == "" {
+			parts = append(parts, codegen.InterpolationPart{Literal: p.Literal})
+			value += p.Literal
+			continue
+		}
+
+		var resolved string
+		var res *types.Resource
+		var ok bool
+		if bound, has := vars[p.Variable]; has {
+			if lit, isString := bound.(string); isString {
+				resolved, ok = lit, true
+			} else if id, isRef := cfn.Ref(bound); isRef {
+				resolved, res, ok = s.resolve(scope, id, "Ref")
+			} else if id, attribute, isGetAtt := cfn.GetAtt(bound); isGetAtt {
+				resolved, res, ok = s.resolve(scope, id, attribute)
+			}
+		} else if i := strings.Index(p.Variable, "."); i >= 0 {
+			resolved, res, ok = s.resolve(scope, p.Variable[:i], p.Variable[i+1:])
+		} else {
+			resolved, res, ok = s.resolve(scope, p.Variable, "Ref")
+		}
+		if !ok {
+			return
+		}
+
+		value += resolved
+		if res == nil {
+			parts = append(parts, codegen.InterpolationPart{Literal: resolved})
+		} else {
+			parts = append(parts, codegen.InterpolationPart{Resource: res})
+			references++
+		}
+	}
+	if references > 0 {
+		s.interpolations[value] = parts
+		for _, p := range parts {
+			if p.Resource != nil && strings.HasPrefix(p.Resource.Type, "data.") {
+				s.pseudoParameters[p.Resource.Type] = true
+			}
+		}
+	}
+}
+
+// resolve returns the value of a Ref or Fn::GetAtt and the resource
+// referencing it, which is nil for literals.
+func (s *Stack) resolve(scope templateScope, logicalID string, attribute string) (string, *types.Resource, bool) {
+	if attribute == "Ref" {
+		if value, res, ok := s.pseudoParameter(scope, logicalID); ok {
+			return value, res, ok
+		}
+		for _, p := range scope.parameters {
+			if p.Key == logicalID {
+				if p.NoEcho || p.Value == "" {
+					return "", nil, false
+				}
+				if scope.flattened {
+					return p.Value, nil, true
+				}
+				return p.Value, &types.Resource{Type: "var", Identifier: p.Key}, true
+			}
+		}
+	}
+
+	for _, rs := range s.ByType {
+		for _, r := range rs {
+			res := r.Resource()
+			if res.Identifier != scope.prefix+logicalID {
+				continue
+			}
+			rv, ok := r.(returning)
+			if !ok {
+				return "", nil, false
+			}
+			attr, has := rv.ReturnValues()[attribute]
+			if !has || attr.Value == "" {
+				return "", nil, false
+			}
+			res.OutputKey = attr.Name
+			return attr.Value, &res, true
+		}
+	}
+	return "", nil, false
+}
+
+// pseudoParameter resolves the pseudo parameters known from the stack id to
+// the data sources holding them.
+func (s *Stack) pseudoParameter(scope templateScope, name string) (string, *types.Resource, bool) {
+	if name == "AWS::StackName" {
+		return scope.stackName, nil, true
+	}
+	// arn:partition:cloudformation:region:account:stack/name/id
+	arn := strings.SplitN(s.StackID, ":", 6)
+	if len(arn) < 6 {
+		return "", nil, false
+	}
+	res, ok := pseudoParameterResource(name)
+	if !ok {
+		return "", nil, false
+	}
+	var value string
+	switch name {
+	case "AWS::Region":
+		value = arn[3]
+	case "AWS::AccountId":
+		value = arn[4]
+	case "AWS::Partition":
+		value = arn[1]
+	case "AWS::URLSuffix":
+		value = dnsSuffix(arn[1])
+	}
+	return value, &res, true
+}
+
+// stackPartition returns the partition of a stack from its id, such as aws-cn,
+// or aws when the id isn't known.
+func stackPartition(stackID string) string {
+	arn := strings.SplitN(stackID, ":", 3)
+	if len(arn) < 3 || arn[1] == "" {
+		return "aws"
+	}
+	return arn[1]
+}
+
+// dnsSuffix returns the domain of the services of a partition.
+func dnsSuffix(partition string) string {
+	if partition == "aws-cn" {
+		return "amazonaws.com.cn"
+	}
+	return "amazonaws.com"
+}
+
+// partitioned resources have arns or domain names in the partition of their
+// stack, which isn't known when they're fetched.
+type partitioned interface {
+	inPartition(partition string) StackResource
+}
+
+// pseudoParameterResource returns the data source holding a pseudo parameter.
+func pseudoParameterResource(name string) (types.Resource, bool) {
+	switch name {
+	case "AWS::Region":
+		return types.Resource{Type: "data.aws_region", Identifier: "current", OutputKey: "name"}, true
+	case "AWS::AccountId":
+		return types.Resource{Type: "data.aws_caller_identity", Identifier: "current", OutputKey: "account_id"}, true
+	case "AWS::Partition":
+		return types.Resource{Type: "data.aws_partition", Identifier: "current", OutputKey: "partition"}, true
+	case "AWS::URLSuffix":
+		return types.Resource{Type: "data.aws_partition", Identifier: "current", OutputKey: "dns_suffix"}, true
+	}
+	return types.Resource{}, false
+}
+
+// pseudoParameterBlocks returns the data sources of the pseudo parameters the
+// template uses.
+func (s Stack) pseudoParameterBlocks() []codegen.HCLResource {
+	blocks := []codegen.HCLResource{}
+	for _, t := range []string{"data.aws_caller_identity", "data.aws_partition", "data.aws_region"} {
+		if s.pseudoParameters[t] {
+			blocks = append(blocks, dataSource(strings.TrimPrefix(t, "data.")))
+		}
+	}
+	return blocks
+}
+
+// dataSource is a data source of the current provider configuration.
+type dataSource string
+
+func (d dataSource) WriteHCL(body *hclwrite.Body, stack codegen.Stack) {
+	body.AppendNewBlock("data", []string{string(d), "current"})
+}
+
+func (d DynamoTable) ReturnValues() map[string]ReturnValue {
+	return map[string]ReturnValue{
+		"Ref":       {"name", str(d.TableName)},
+		"Arn":       {"arn", str(d.TableArn)},
+		"StreamArn": {"stream_arn", str(d.LatestStreamArn)},
+	}
+}
+
+func (r Role) ReturnValues() map[string]ReturnValue {
+	return map[string]ReturnValue{
+		"Ref":    {"name", str(r.RoleName)},
+		"Arn":    {"arn", str(r.Role.Arn)},
+		"RoleId": {"unique_id", str(r.RoleId)},
+	}
+}
+
+func (f FirehoseDeliveryStream) ReturnValues() map[string]ReturnValue {
+	return map[string]ReturnValue{
+		"Ref": {"name", str(f.DeliveryStreamName)},
+		"Arn": {"arn", str(f.DeliveryStreamARN)},
+	}
+}
+
+func (l LambdaFunctionConfiguration) ReturnValues() map[string]ReturnValue {
+	return map[string]ReturnValue{
+		"Ref": {"function_name", str(l.FunctionName)},
+		"Arn": {"arn", str(l.FunctionArn)},
+	}
+}
+
+func (l LambdaEventSource) ReturnValues() map[string]ReturnValue {
+	return map[string]ReturnValue{
+		"Ref": {"uuid", str(l.UUID)},
+	}
+}
+
+// ReturnValues leaves out the arn, which CloudFormation suffixes with :* and
+// terraform doesn't.
+func (l LogGroup) ReturnValues() map[string]ReturnValue {
+	return map[string]ReturnValue{
+		"Ref": {"name", str(l.LogGroupName)},
+	}
+}
+
+func (t Topic) ReturnValues() map[string]ReturnValue {
+	return map[string]ReturnValue{
+		"Ref":       {"arn", t.Attributes["TopicArn"]},
+		"TopicName": {"name", t.TopicName()},
+	}
+}
+
+func (t TopicSubscription) ReturnValues() map[string]ReturnValue {
+	return map[string]ReturnValue{
+		"Ref": {"arn", t.Attributes["SubscriptionArn"]},
+	}
+}
+
+func (q Queue) ReturnValues() map[string]ReturnValue {
+	return map[string]ReturnValue{
+		"Ref":       {"url", q.QueueUrl()},
+		"Arn":       {"arn", q.Attributes["QueueArn"]},
+		"QueueName": {"name", q.QueueName()},
+	}
+}
+
+func str(s *string) string {
+	if s == nil {
+		return ""
+	}
+	return *s
+}
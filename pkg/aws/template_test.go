@@ -0,0 +1,129 @@
+package aws
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/cr-norton/tfconvert/pkg/codegen"
+	"github.com/cr-norton/tfconvert/pkg/types"
+)
+
+func TestApplyTemplate(t *testing.T) {
+	queue := Queue{
+		LogicalID: "Queue",
+		URL:       "https://sqs.us-east-1.amazonaws.com/123456789012/orders",
+		Attributes: map[string]string{
+			"QueueArn": "arn:aws:sqs:us-east-1:123456789012:orders",
+		},
+	}
+	stack := &Stack{
+		Name:    "shop",
+		StackID: "arn:aws:cloudformation:us-east-1:123456789012:stack/shop/1",
+		Index:   map[string]types.Resource{},
+		Parameters: []Parameter{
+			{Key: "Environment", Value: "production"},
+			{Key: "Principal", Value: "*"},
+			{Key: "Enabled", Value: "true"},
+			{Key: "Retention", Value: "14"},
+			{Key: "Secret", Value: "****", NoEcho: true},
+		},
+		Template: `
+Parameters:
+  Environment: {Type: String}
+  Principal: {Type: String}
+  Enabled: {Type: String}
+  Retention: {Type: Number}
+  Secret: {Type: String, NoEcho: true}
+Resources:
+  Queue:
+    Type: AWS::SQS::Queue
+  Function:
+    Type: AWS::Lambda::Function
+    Properties:
+      Environment:
+        Variables:
+          QUEUE: !Ref Queue
+          QUEUE_ARN: !GetAtt Queue.Arn
+          STAGE: !Ref Environment
+          PRINCIPAL: !Ref Principal
+          ENABLED: !Ref Enabled
+          RETENTION: !Ref Retention
+          SECRET: !Ref Secret
+          TOPIC: !Sub "arn:aws:sns:${AWS::Region}:${AWS::AccountId}:${Environment}-${Queue.QueueName}"
+          LITERAL: !Sub "${!Literal}-${Environment}"
+          REGION: !Ref AWS::Region
+          ACCOUNT: !Ref AWS::AccountId
+          PARTITION: !Ref AWS::Partition
+          SUFFIX: !Ref AWS::URLSuffix
+`,
+		StackResources: &StackResources{ByType: map[string][]StackResource{
+			"AWS::SQS::Queue": {queue},
+		}},
+	}
+	if err := stack.applyTemplate(); err != nil {
+		t.Fatal(err)
+	}
+
+	queueResource := func(attribute string) types.Resource {
+		res := queue.Resource()
+		res.OutputKey = attribute
+		return res
+	}
+	environment := types.Resource{Type: "var", Identifier: "Environment"}
+	wantIndex := map[string]types.Resource{
+		"https://sqs.us-east-1.amazonaws.com/123456789012/orders": queueResource("url"),
+		"arn:aws:sqs:us-east-1:123456789012:orders":               queueResource("arn"),
+		"production": environment,
+	}
+	if !reflect.DeepEqual(stack.Index, wantIndex) {
+		t.Errorf("Index = %#v, want %#v", stack.Index, wantIndex)
+	}
+
+	name := queueResource("name")
+	region := types.Resource{Type: "data.aws_region", Identifier: "current", OutputKey: "name"}
+	account := types.Resource{Type: "data.aws_caller_identity", Identifier: "current", OutputKey: "account_id"}
+	wantInterpolations := map[string][]codegen.InterpolationPart{
+		"arn:aws:sns:us-east-1:123456789012:production-orders": {
+			{Literal: "arn:aws:sns:"},
+			{Resource: &region},
+			{Literal: ":"},
+			{Resource: &account},
+			{Literal: ":"},
+			{Resource: &environment},
+			{Literal: "-"},
+			{Resource: &name},
+		},
+		"${Literal}-production": {
+			{Literal: "${Literal}-"},
+			{Resource: &environment},
+		},
+	}
+	if !reflect.DeepEqual(stack.interpolations, wantInterpolations) {
+		t.Errorf("interpolations = %#v, want %#v", stack.interpolations, wantInterpolations)
+	}
+
+	wantPseudoParameters := map[string]bool{"data.aws_region": true, "data.aws_caller_identity": true}
+	if !reflect.DeepEqual(stack.pseudoParameters, wantPseudoParameters) {
+		t.Errorf("pseudoParameters = %v, want %v", stack.pseudoParameters, wantPseudoParameters)
+	}
+}
+
+func TestIndexable(t *testing.T) {
+	tests := map[string]bool{
+		"production": true,
+		"orders-v2":  true,
+		"*":          false,
+		"us":         false,
+		"true":       false,
+		"false":      false,
+		"1":          false,
+		"2048":       false,
+		"0.5":        false,
+		"---":        false,
+	}
+	for value, want := range tests {
+		if got := indexable(value); got != want {
+			t.Errorf("indexable(%q) = %v, want %v", value, got, want)
+		}
+	}
+}
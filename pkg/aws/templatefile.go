@@ -0,0 +1,1142 @@
+package aws
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	apigatewayTypes "github.com/aws/aws-sdk-go-v2/service/apigateway/types"
+	dynamodbTypes "github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	firehoseTypes "github.com/aws/aws-sdk-go-v2/service/firehose/types"
+	iamTypes "github.com/aws/aws-sdk-go-v2/service/iam/types"
+	lambdaTypes "github.com/aws/aws-sdk-go-v2/service/lambda/types"
+	"github.com/cr-norton/tfconvert/pkg/cfn"
+	"github.com/cr-norton/tfconvert/pkg/codegen"
+	"github.com/cr-norton/tfconvert/pkg/types"
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+)
+
+// TemplateFunc converts a resource declared in a template file.
+type TemplateFunc func(logicalID string, properties Properties) (StackResource, error)
+
+// TemplateHandler is implemented by handlers that convert resources declared
+// in a template file as well as deployed ones.
+type TemplateHandler interface {
+	ResourceHandler
+	FromTemplate(logicalID string, properties Properties) (StackResource, error)
+}
+
+type templateHandler struct {
+	ResourceHandler
+	fromTemplate TemplateFunc
+}
+
+// WithTemplate adds the conversion of resources declared in a template file
+// to a handler.
+func WithTemplate(h ResourceHandler, fromTemplate TemplateFunc) TemplateHandler {
+	return templateHandler{ResourceHandler: h, fromTemplate: fromTemplate}
+}
+
+func (h templateHandler) FromTemplate(logicalID string, properties Properties) (StackResource, error) {
+	return h.fromTemplate(logicalID, properties)
+}
+
+// LoadTemplate converts the resources declared in a template file without
+// calling aws, expanding the AWS::Serverless resources of SAM templates.
+// Physical ids and attributes aren't known, so every Ref and Fn::GetAtt
+// resolves to a placeholder such as ${Queue.Arn}, which is indexed as a
+// reference once every resource is converted.
+func LoadTemplate(body []byte, options types.Options) (*Stack, error) {
+	t, err := cfn.Parse(body)
+	if err != nil {
+		return nil, err
+	}
+	if t.Serverless() {
+		t.ExpandServerless()
+	}
+
+	r := &templateResolver{
+		stackName:  options.StackName,
+		parameters: t.Parameters,
+		references: map[string]templateRef{},
+		subs:       map[string][]templatePart{},
+		numbers:    map[string]string{},
+		resources:  t.Resources,
+		children:   map[string]types.Resource{},
+	}
+
+	stackres := &StackResources{ByType: map[string][]StackResource{}}
+	versions := map[string][]LambdaVersion{}
+	for _, id := range t.LogicalIDs() {
+		resource := t.Resources[id]
+		if resource.Type == lambdaVersionType {
+			function, v := lambdaVersionFromTemplate(id, Properties{values: resource.Properties, resolver: r, path: id})
+			versions[function] = append(versions[function], v)
+			continue
+		}
+		h, has := Handler(resource.Type)
+		th, ok := h.(TemplateHandler)
+		if !has || !ok {
+			if !ignored[resource.Type] {
+				log.WithFields(log.Fields{
+					"resource_type": resource.Type,
+					"logical_id":    id,
+				}).Warn("unsupported template resource")
+			}
+			continue
+		}
+
+		res, err := th.FromTemplate(id, Properties{values: resource.Properties, resolver: r, path: id})
+		if err != nil {
+			return nil, errors.Wrapf(err, "unable to convert %s %s", resource.Type, id)
+		}
+		if err := stackres.add(h, res); err != nil {
+			return nil, err
+		}
+	}
+	attachLambdaVersions(stackres, versions)
+
+	serviceName := options.ServiceName
+	if serviceName == "" {
+		serviceName = options.StackName
+	}
+	refs := NewExportReferences(options)
+	if refs.Mode == types.ExportReferencesRemoteState {
+		// the stacks exporting the imported values aren't known without aws
+		log.Warn("remote_state export references need the deployed stack, using data sources")
+		refs.Mode = types.ExportReferencesData
+	}
+	stack := &Stack{
+		Name:             options.StackName,
+		ServiceName:      serviceName,
+		AdditionalTags:   options.AdditionalTags,
+		Index:            index(stackres),
+		ExportReferences: refs,
+		StackResources:   stackres,
+		interpolations:   map[string][]codegen.InterpolationPart{},
+		pseudoParameters: map[string]bool{},
+		numbers:          map[string]string{},
+	}
+
+	keys := []string{}
+	for key := range t.Parameters {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		p := t.Parameters[key]
+		parameter := Parameter{Key: key, Type: p.Type, Description: p.Description}
+		if p.Default != nil {
+			def := scalar(p.Default)
+			parameter.Default = &def
+		}
+		parameter.NoEcho = scalar(p.NoEcho) == "true"
+		stack.Parameters = append(stack.Parameters, parameter)
+	}
+
+	keys = []string{}
+	for key := range t.Outputs {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		o := t.Outputs[key]
+		value, _ := r.resolve(o.Value)
+		stack.Outputs = append(stack.Outputs, Output{Key: key, Value: value, Description: o.Description})
+	}
+
+	r.apply(stack)
+	return stack, nil
+}
+
+// templateRef is a Ref, keyed "Ref", or Fn::GetAtt of a template.
+type templateRef struct {
+	logicalID string
+	attribute string
+}
+
+// templatePart is a literal or a reference of a resolved string.
+type templatePart struct {
+	literal string
+	ref     *templateRef
+}
+
+// templateResolver resolves the intrinsic functions of a template to
+// placeholders and records what they stand for.
+type templateResolver struct {
+	stackName  string
+	parameters map[string]cfn.Parameter
+	// references are the placeholders of every Ref and Fn::GetAtt
+	references map[string]templateRef
+	// subs are the strings built from references, such as by Fn::Sub
+	subs map[string][]templatePart
+	// numbers are the numeric properties set from references, such as a
+	// MemorySize set by a parameter, keyed by their path
+	numbers map[string]string
+	exports []Export
+	// resources are the resources of the template, of which those converted
+	// along with their parent are found by referencing
+	resources map[string]cfn.Resource
+	// children are the terraform resources of the placeholders of resources
+	// converted along with their parent
+	children map[string]types.Resource
+}
+
+// placeholder is the value a Ref or Fn::GetAtt resolves to, such as ${Queue.Arn}.
+func (r *templateResolver) placeholder(logicalID string, attribute string) string {
+	if attribute == "Ref" {
+		return "${" + logicalID + "}"
+	}
+	return "${" + logicalID + "." + attribute + "}"
+}
+
+// resolve resolves a value to a string. Values built from more than one part
+// are recorded so they can be written as string templates.
+func (r *templateResolver) resolve(v interface{}) (string, bool) {
+	parts, ok := r.parts(v)
+	if !ok {
+		return "", false
+	}
+	value := ""
+	references := 0
+	for _, p := range parts {
+		value += p.literal
+		if p.ref != nil {
+			references++
+		}
+	}
+	if references > 0 && len(parts) > 1 {
+		r.subs[value] = parts
+	}
+	return value, true
+}
+
+func (r *templateResolver) parts(v interface{}) ([]templatePart, bool) {
+	name, arg, ok := cfn.Intrinsic(v)
+	if !ok {
+		if v == nil {
+			return nil, false
+		}
+		if _, isMap := v.(map[string]interface{}); isMap {
+			return nil, false
+		}
+		if _, isList := v.([]interface{}); isList {
+			return nil, false
+		}
+		return []templatePart{{literal: scalar(v)}}, true
+	}
+
+	switch name {
+	case "Ref":
+		id, _ := cfn.Ref(v)
+		return r.ref(id, "Ref")
+	case "Fn::GetAtt":
+		id, attribute, ok := cfn.GetAtt(v)
+		if !ok {
+			return nil, false
+		}
+		return r.ref(id, attribute)
+	case "Fn::Sub":
+		format, vars, ok := cfn.Sub(v)
+		if !ok {
+			return nil, false
+		}
+		parts := []templatePart{}
+		for _, p := range cfn.SubParts(format) {
+			var resolved []templatePart
+			var ok bool
+			if p.Variable == "" {
+				resolved, ok = []templatePart{{literal: p.Literal}}, true
+			} else if bound, has := vars[p.Variable]; has {
+				resolved, ok = r.parts(bound)
+			} else if i := strings.Index(p.Variable, "."); i >= 0 && !strings.HasPrefix(p.Variable, "AWS::") {
+				resolved, ok = r.ref(p.Variable[:i], p.Variable[i+1:])
+			} else {
+				resolved, ok = r.ref(p.Variable, "Ref")
+			}
+			if !ok {
+				return nil, false
+			}
+			parts = append(parts, resolved...)
+		}
+		return parts, true
+	case "Fn::Join":
+		args, ok := arg.([]interface{})
+		if !ok || len(args) != 2 {
+			return nil, false
+		}
+		delimiter, ok1 := args[0].(string)
+		values, ok2 := args[1].([]interface{})
+		if !ok1 || !ok2 {
+			return nil, false
+		}
+		parts := []templatePart{}
+		for i, value := range values {
+			if i > 0 && delimiter != "" {
+				parts = append(parts, templatePart{literal: delimiter})
+			}
+			resolved, ok := r.parts(value)
+			if !ok {
+				return nil, false
+			}
+			parts = append(parts, resolved...)
+		}
+		return parts, true
+	case "Fn::ImportValue":
+		exportName, ok := r.resolve(arg)
+		if !ok {
+			return nil, false
+		}
+		p := "${ImportValue:" + exportName + "}"
+		r.exports = append(r.exports, Export{Name: exportName, Value: p})
+		return []templatePart{{literal: p}}, true
+	}
+	return nil, false
+}
+
+// templateChild is a resource of a template converted along with its parent.
+type templateChild struct {
+	logicalID  string
+	properties Properties
+}
+
+// referencing returns the resources of a type whose property is a Ref of a
+// resource, such as the stages of a rest api, ordered by logical id.
+func (r *templateResolver) referencing(resourceType string, property string, logicalID string) []templateChild {
+	ids := []string{}
+	for id, res := range r.resources {
+		if res.Type != resourceType {
+			continue
+		}
+		if ref, ok := cfn.Ref(res.Properties[property]); ok && ref == logicalID {
+			ids = append(ids, id)
+		}
+	}
+	sort.Strings(ids)
+
+	children := []templateChild{}
+	for _, id := range ids {
+		children = append(children, templateChild{
+			logicalID:  id,
+			properties: Properties{values: r.resources[id].Properties, resolver: r, path: id},
+		})
+	}
+	return children
+}
+
+func (r *templateResolver) ref(logicalID string, attribute string) ([]templatePart, bool) {
+	if logicalID == "AWS::StackName" {
+		return []templatePart{{literal: r.stackName}}, true
+	}
+	ref := templateRef{logicalID: logicalID, attribute: attribute}
+	p := r.placeholder(logicalID, attribute)
+	r.references[p] = ref
+	return []templatePart{{literal: p, ref: &ref}}, true
+}
+
+// apply indexes the placeholders of the stack as references to the resources,
+// variables and data sources they stand for.
+func (r *templateResolver) apply(stack *Stack) {
+	resources := map[string]types.Resource{}
+	for p, ref := range r.references {
+		if res, has := stack.Index[p]; has {
+			resources[p] = res
+			continue
+		}
+		if res, has := r.children[p]; has {
+			resources[p] = res
+			stack.addIndex(p, res)
+			continue
+		}
+		res, ok := r.reference(stack, ref)
+		if !ok {
+			log.WithFields(log.Fields{
+				"logical_id": ref.logicalID,
+				"attribute":  ref.attribute,
+			}).Warn("unable to resolve template reference")
+			continue
+		}
+		resources[p] = res
+		// placeholders are unique, unlike the values of a deployed stack
+		stack.Index[p] = res
+	}
+
+	for value, parts := range r.subs {
+		interpolation := []codegen.InterpolationPart{}
+		for _, p := range parts {
+			if res, has := resources[p.literal]; has && p.ref != nil {
+				res := res
+				interpolation = append(interpolation, codegen.InterpolationPart{Resource: &res})
+			} else {
+				interpolation = append(interpolation, codegen.InterpolationPart{Literal: p.literal})
+			}
+		}
+		stack.interpolations[value] = interpolation
+	}
+
+	for _, e := range r.exports {
+		stack.Exports = append(stack.Exports, e)
+	}
+	for path, p := range r.numbers {
+		stack.numbers[path] = p
+	}
+}
+
+func (r *templateResolver) reference(stack *Stack, ref templateRef) (types.Resource, bool) {
+	if ref.attribute == "Ref" {
+		if res, ok := pseudoParameterResource(ref.logicalID); ok {
+			stack.pseudoParameters[res.Type] = true
+			return res, true
+		}
+		if _, has := r.parameters[ref.logicalID]; has {
+			return types.Resource{Type: "var", Identifier: ref.logicalID}, true
+		}
+	}
+
+	for _, rs := range stack.ByType {
+		for _, sr := range rs {
+			res := sr.Resource()
+			if res.Identifier != ref.logicalID {
+				continue
+			}
+			rv, ok := sr.(returning)
+			if !ok {
+				return types.Resource{}, false
+			}
+			attr, has := rv.ReturnValues()[ref.attribute]
+			if !has {
+				return types.Resource{}, false
+			}
+			res.OutputKey = attr.Name
+			return res, true
+		}
+	}
+	return types.Resource{}, false
+}
+
+// scalar formats a scalar template value as CloudFormation passes it.
+func scalar(v interface{}) string {
+	switch t := v.(type) {
+	case nil:
+		return ""
+	case string:
+		return t
+	case float64:
+		return strconv.FormatFloat(t, 'f', -1, 64)
+	default:
+		return fmt.Sprint(t)
+	}
+}
+
+// Properties are the properties of a resource declared in a template file,
+// with intrinsic functions resolved to placeholders.
+type Properties struct {
+	values   map[string]interface{}
+	resolver *templateResolver
+	// path is the logical id of the resource followed by the names of the
+	// properties holding these, such as Function.EphemeralStorage
+	path string
+}
+
+// Has reports whether a property is set.
+func (p Properties) Has(name string) bool {
+	_, has := p.values[name]
+	return has
+}
+
+// String returns a property as a string, nil when it's missing or can't be resolved.
+func (p Properties) String(name string) *string {
+	v, has := p.values[name]
+	if !has {
+		return nil
+	}
+	s, ok := p.resolver.resolve(v)
+	if !ok {
+		log.WithField("property", name).Warn("unable to resolve template property")
+		return nil
+	}
+	return &s
+}
+
+// Name returns a name property, or a name made of the stack name and logical
+// id like CloudFormation generates when it's missing.
+func (p Properties) Name(name string, logicalID string) *string {
+	if s := p.String(name); s != nil {
+		return s
+	}
+	generated := logicalID
+	if p.resolver.stackName != "" {
+		generated = p.resolver.stackName + "-" + logicalID
+	}
+	return &generated
+}
+
+// Int64 returns a numeric property. A property set from a reference such as
+// a parameter is nil, and its placeholder recorded under the path of the
+// property so it's written as the reference.
+func (p Properties) Int64(name string) *int64 {
+	s := p.String(name)
+	if s == nil {
+		return nil
+	}
+	i, err := strconv.ParseInt(*s, 10, 64)
+	if err != nil {
+		if strings.Contains(*s, "${") {
+			p.resolver.numbers[p.path+"."+name] = *s
+		} else {
+			log.WithFields(log.Fields{
+				"property": p.path + "." + name,
+				"value":    *s,
+			}).Warn("template property is not a number")
+		}
+		return nil
+	}
+	return &i
+}
+
+// Int32 returns a numeric property.
+func (p Properties) Int32(name string) *int32 {
+	i := p.Int64(name)
+	if i == nil {
+		return nil
+	}
+	i32 := int32(*i)
+	return &i32
+}
+
+// Strings returns a list property.
+func (p Properties) Strings(name string) []string {
+	values, _ := p.values[name].([]interface{})
+	strs := []string{}
+	for _, v := range values {
+		if s, ok := p.resolver.resolve(v); ok {
+			strs = append(strs, s)
+		}
+	}
+	return strs
+}
+
+// StringMap returns a map property.
+func (p Properties) StringMap(name string) map[string]string {
+	values, _ := p.values[name].(map[string]interface{})
+	m := map[string]string{}
+	for k, v := range values {
+		if s, ok := p.resolver.resolve(v); ok {
+			m[k] = s
+		}
+	}
+	return m
+}
+
+// Object returns a nested object property.
+func (p Properties) Object(name string) (Properties, bool) {
+	values, ok := p.values[name].(map[string]interface{})
+	return Properties{values: values, resolver: p.resolver, path: p.path + "." + name}, ok
+}
+
+// Objects returns a list of nested objects.
+func (p Properties) Objects(name string) []Properties {
+	values, _ := p.values[name].([]interface{})
+	objects := []Properties{}
+	for i, v := range values {
+		if m, ok := v.(map[string]interface{}); ok {
+			path := fmt.Sprintf("%s.%s.%d", p.path, name, i)
+			objects = append(objects, Properties{values: m, resolver: p.resolver, path: path})
+		}
+	}
+	return objects
+}
+
+// JSON returns a property such as a policy document as json, with intrinsic
+// functions resolved.
+func (p Properties) JSON(name string) *string {
+	v, has := p.values[name]
+	if !has {
+		return nil
+	}
+	if s, ok := v.(string); ok {
+		return &s
+	}
+	bytes, err := json.Marshal(p.resolveAll(v))
+	if err != nil {
+		return nil
+	}
+	s := string(bytes)
+	return &s
+}
+
+func (p Properties) resolveAll(v interface{}) interface{} {
+	if _, _, ok := cfn.Intrinsic(v); ok {
+		s, _ := p.resolver.resolve(v)
+		return s
+	}
+	switch t := v.(type) {
+	case map[string]interface{}:
+		m := map[string]interface{}{}
+		for k, e := range t {
+			m[k] = p.resolveAll(e)
+		}
+		return m
+	case []interface{}:
+		l := []interface{}{}
+		for _, e := range t {
+			l = append(l, p.resolveAll(e))
+		}
+		return l
+	}
+	return v
+}
+
+// templateArn is the arn of a resource declared in a template file, which
+// only serves to derive its name.
+func templateArn(service string, name string) string {
+	return fmt.Sprintf("arn:aws:%s:${AWS::Region}:${AWS::AccountId}:%s", service, name)
+}
+
+func dynamoTableFromTemplate(logicalID string, p Properties) (StackResource, error) {
+	t := DynamoTable{LogicalID: logicalID}
+	t.TableName = p.Name("TableName", logicalID)
+	arn := p.resolver.placeholder(logicalID, "Arn")
+	t.TableArn = &arn
+	t.KeySchema = keySchema(p)
+	for _, a := range p.Objects("AttributeDefinitions") {
+		t.AttributeDefinitions = append(t.AttributeDefinitions, dynamodbTypes.AttributeDefinition{
+			AttributeName: a.String("AttributeName"),
+			AttributeType: dynamodbTypes.ScalarAttributeType(str(a.String("AttributeType"))),
+		})
+	}
+	if mode := p.String("BillingMode"); mode != nil {
+		t.BillingModeSummary = &dynamodbTypes.BillingModeSummary{BillingMode: dynamodbTypes.BillingMode(*mode)}
+	}
+	t.ProvisionedThroughput = provisionedThroughput(p)
+	for _, g := range p.Objects("GlobalSecondaryIndexes") {
+		gsi := dynamodbTypes.GlobalSecondaryIndexDescription{
+			IndexName:             g.String("IndexName"),
+			KeySchema:             keySchema(g),
+			ProvisionedThroughput: provisionedThroughput(g),
+		}
+		if projection, ok := g.Object("Projection"); ok {
+			gsi.Projection = &dynamodbTypes.Projection{
+				ProjectionType:   dynamodbTypes.ProjectionType(str(projection.String("ProjectionType"))),
+				NonKeyAttributes: projection.Strings("NonKeyAttributes"),
+			}
+		}
+		t.GlobalSecondaryIndexes = append(t.GlobalSecondaryIndexes, gsi)
+	}
+	if p.Has("StreamSpecification") {
+		stream := p.resolver.placeholder(logicalID, "StreamArn")
+		t.LatestStreamArn = &stream
+	}
+	return t, nil
+}
+
+func keySchema(p Properties) []dynamodbTypes.KeySchemaElement {
+	schema := []dynamodbTypes.KeySchemaElement{}
+	for _, k := range p.Objects("KeySchema") {
+		schema = append(schema, dynamodbTypes.KeySchemaElement{
+			AttributeName: k.String("AttributeName"),
+			KeyType:       dynamodbTypes.KeyType(str(k.String("KeyType"))),
+		})
+	}
+	return schema
+}
+
+func provisionedThroughput(p Properties) *dynamodbTypes.ProvisionedThroughputDescription {
+	throughput, ok := p.Object("ProvisionedThroughput")
+	if !ok {
+		return nil
+	}
+	return &dynamodbTypes.ProvisionedThroughputDescription{
+		ReadCapacityUnits:  throughput.Int64("ReadCapacityUnits"),
+		WriteCapacityUnits: throughput.Int64("WriteCapacityUnits"),
+	}
+}
+
+func roleFromTemplate(logicalID string, p Properties) (StackResource, error) {
+	r := Role{LogicalID: logicalID, PolicyDocuments: map[string]string{}}
+	r.RoleName = p.Name("RoleName", logicalID)
+	arn, id := p.resolver.placeholder(logicalID, "Arn"), p.resolver.placeholder(logicalID, "RoleId")
+	r.Role.Arn, r.RoleId = &arn, &id
+	r.Path = p.String("Path")
+	r.AssumeRolePolicyDocument = p.JSON("AssumeRolePolicyDocument")
+	for _, policy := range p.Objects("Policies") {
+		name, document := policy.String("PolicyName"), policy.JSON("PolicyDocument")
+		if name != nil && document != nil {
+			r.PolicyDocuments[*name] = *document
+		}
+	}
+	for _, arn := range p.Strings("ManagedPolicyArns") {
+		arn := arn
+		r.AttachedPolicies = append(r.AttachedPolicies, iamTypes.Policy{Arn: &arn})
+	}
+	return r, nil
+}
+
+func firehoseDeliveryStreamFromTemplate(logicalID string, p Properties) (StackResource, error) {
+	f := FirehoseDeliveryStream{LogicalID: logicalID}
+	f.DeliveryStreamName = p.Name("DeliveryStreamName", logicalID)
+	arn := p.resolver.placeholder(logicalID, "Arn")
+	f.DeliveryStreamARN = &arn
+	if s3, ok := p.Object("ExtendedS3DestinationConfiguration"); ok {
+		dest := &firehoseTypes.ExtendedS3DestinationDescription{
+			RoleARN:           s3.String("RoleARN"),
+			BucketARN:         s3.String("BucketARN"),
+			Prefix:            s3.String("Prefix"),
+			ErrorOutputPrefix: s3.String("ErrorOutputPrefix"),
+			CompressionFormat: firehoseTypes.CompressionFormat(str(s3.String("CompressionFormat"))),
+		}
+		if hints, ok := s3.Object("BufferingHints"); ok {
+			dest.BufferingHints = &firehoseTypes.BufferingHints{
+				SizeInMBs:         hints.Int32("SizeInMBs"),
+				IntervalInSeconds: hints.Int32("IntervalInSeconds"),
+			}
+		}
+		f.Destinations = append(f.Destinations, firehoseTypes.DestinationDescription{ExtendedS3DestinationDescription: dest})
+	}
+	return f, nil
+}
+
+func lambdaFunctionFromTemplate(logicalID string, p Properties) (StackResource, error) {
+	l := LambdaFunctionConfiguration{LogicalID: logicalID}
+	l.FunctionName = p.Name("FunctionName", logicalID)
+	arn := p.resolver.placeholder(logicalID, "Arn")
+	l.FunctionArn = &arn
+	l.Role = p.String("Role")
+	l.Handler = p.String("Handler")
+	l.Runtime = lambdaTypes.Runtime(str(p.String("Runtime")))
+	// the defaults of CloudFormation, which the api always returns
+	l.MemorySize, l.Timeout = p.Int32("MemorySize"), p.Int32("Timeout")
+	if !p.Has("MemorySize") {
+		memorySize := int32(128)
+		l.MemorySize = &memorySize
+	}
+	if !p.Has("Timeout") {
+		timeout := int32(3)
+		l.Timeout = &timeout
+	}
+	if env, ok := p.Object("Environment"); ok {
+		l.Environment = &lambdaTypes.EnvironmentResponse{Variables: env.StringMap("Variables")}
+	}
+	for _, arn := range p.Strings("Layers") {
+		arn := arn
+		l.Layers = append(l.Layers, lambdaTypes.Layer{Arn: &arn})
+	}
+	l.Description = p.String("Description")
+	l.KMSKeyArn = p.String("KmsKeyArn")
+	l.ReservedConcurrentExecutions = p.Int32("ReservedConcurrentExecutions")
+	l.PackageType = lambdaTypes.PackageType(str(p.String("PackageType")))
+	if code, ok := p.Object("Code"); ok {
+		l.ImageUri = code.String("ImageUri")
+	}
+	if c, ok := p.Object("ImageConfig"); ok {
+		l.ImageConfigResponse = &lambdaTypes.ImageConfigResponse{ImageConfig: &lambdaTypes.ImageConfig{
+			Command:          c.Strings("Command"),
+			EntryPoint:       c.Strings("EntryPoint"),
+			WorkingDirectory: c.String("WorkingDirectory"),
+		}}
+	}
+	for _, a := range p.Strings("Architectures") {
+		l.Architectures = append(l.Architectures, lambdaTypes.Architecture(a))
+	}
+	if s, ok := p.Object("EphemeralStorage"); ok && s.Has("Size") {
+		l.EphemeralStorage = &lambdaTypes.EphemeralStorage{Size: s.Int32("Size")}
+	}
+	if c, ok := p.Object("VpcConfig"); ok {
+		l.VpcConfig = &lambdaTypes.VpcConfigResponse{
+			SubnetIds:        c.Strings("SubnetIds"),
+			SecurityGroupIds: c.Strings("SecurityGroupIds"),
+		}
+	}
+	if c, ok := p.Object("DeadLetterConfig"); ok {
+		l.DeadLetterConfig = &lambdaTypes.DeadLetterConfig{TargetArn: c.String("TargetArn")}
+	}
+	if c, ok := p.Object("TracingConfig"); ok {
+		l.TracingConfig = &lambdaTypes.TracingConfigResponse{Mode: lambdaTypes.TracingMode(str(c.String("Mode")))}
+	}
+	for _, c := range p.Objects("FileSystemConfigs") {
+		l.FileSystemConfigs = append(l.FileSystemConfigs, lambdaTypes.FileSystemConfig{
+			Arn:            c.String("Arn"),
+			LocalMountPath: c.String("LocalMountPath"),
+		})
+	}
+	return l, nil
+}
+
+// lambdaVersionFromTemplate converts a version along with the logical id of
+// its function. The version a template publishes is the current version of
+// its function, so references to it are written as the version and
+// qualified_arn of the function.
+func lambdaVersionFromTemplate(logicalID string, p Properties) (string, LambdaVersion) {
+	v := LambdaVersion{LogicalID: logicalID}
+	v.FunctionArn = p.resolver.placeholder(logicalID, "Ref")
+	parts, _ := p.resolver.ref(logicalID, "Version")
+	v.Version = parts[0].literal
+	v.ProvisionedConcurrency = provisionedConcurrency(p)
+
+	function, ok := cfn.Ref(p.values["FunctionName"])
+	if !ok {
+		return "", v
+	}
+	res := types.Resource{Type: "aws_lambda_function", Identifier: function, OutputKey: "qualified_arn"}
+	p.resolver.children[v.FunctionArn] = res
+	res.OutputKey = "version"
+	p.resolver.children[v.Version] = res
+	return function, v
+}
+
+// attachLambdaVersions moves the versions of a template to their functions,
+// keyed by the logical id of the function. Versions of functions outside the
+// template are dropped with a warning.
+func attachLambdaVersions(stack *StackResources, versions map[string][]LambdaVersion) {
+	functions := stack.ByType["AWS::Lambda::Function"]
+	for i, r := range functions {
+		f := r.(LambdaFunctionConfiguration)
+		vs := versions[f.LogicalID]
+		if len(vs) == 0 {
+			continue
+		}
+		f.Versions = vs
+		f.LatestVersion = vs[len(vs)-1].Version
+		functions[i] = f
+		delete(versions, f.LogicalID)
+	}
+	for function, vs := range versions {
+		for _, v := range vs {
+			log.WithFields(log.Fields{
+				"logical_id": v.LogicalID,
+				"function":   function,
+			}).Warn("unable to convert the version of a function outside the template")
+		}
+	}
+}
+
+// lambdaAliasFromTemplate converts an alias. Weights of versions published
+// by the template can't be written as the keys of a map, so they're dropped
+// with a warning.
+func lambdaAliasFromTemplate(logicalID string, p Properties) (StackResource, error) {
+	a := LambdaAlias{LogicalID: logicalID, FunctionArn: str(p.String("FunctionName"))}
+	arn := p.resolver.placeholder(logicalID, "Ref")
+	a.AliasArn = &arn
+	a.Name = p.String("Name")
+	a.Description = p.String("Description")
+	a.FunctionVersion = p.String("FunctionVersion")
+	if c, ok := p.Object("RoutingConfig"); ok {
+		weights := map[string]float64{}
+		for _, w := range c.Objects("AdditionalVersionWeights") {
+			version, weight := str(w.String("FunctionVersion")), str(w.String("FunctionWeight"))
+			f, err := strconv.ParseFloat(weight, 64)
+			if strings.Contains(version, "${") || err != nil {
+				log.WithFields(log.Fields{
+					"logical_id": logicalID,
+					"version":    version,
+					"weight":     weight,
+				}).Warn("unable to convert the weight of an alias version")
+				continue
+			}
+			weights[version] = f
+		}
+		a.RoutingConfig = &lambdaTypes.AliasRoutingConfiguration{AdditionalVersionWeights: weights}
+	}
+	a.ProvisionedConcurrency = provisionedConcurrency(p)
+	return a, nil
+}
+
+// provisionedConcurrency returns the provisioned concurrency of a version or
+// alias. Concurrency set from a reference is returned as zero, so the config
+// is written with the reference in its place.
+func provisionedConcurrency(p Properties) *int32 {
+	c, ok := p.Object("ProvisionedConcurrencyConfig")
+	if !ok || !c.Has("ProvisionedConcurrentExecutions") {
+		return nil
+	}
+	if i := c.Int32("ProvisionedConcurrentExecutions"); i != nil {
+		return i
+	}
+	zero := int32(0)
+	return &zero
+}
+
+func lambdaLayerVersionFromTemplate(logicalID string, p Properties) (StackResource, error) {
+	l := LambdaLayerVersion{LogicalID: logicalID}
+	name := p.Name("LayerName", logicalID)
+	l.LayerArn = templateArn("lambda", "layer:"+*name)
+	l.LayerVersionArn = p.resolver.placeholder(logicalID, "Ref")
+	l.Description = p.String("Description")
+	for _, r := range p.Strings("CompatibleRuntimes") {
+		l.CompatibleRuntimes = append(l.CompatibleRuntimes, lambdaTypes.Runtime(r))
+	}
+	l.LicenseInfo = p.String("LicenseInfo")
+	return l, nil
+}
+
+func lambdaEventSourceFromTemplate(logicalID string, p Properties) (StackResource, error) {
+	e := LambdaEventSource{LogicalID: logicalID}
+	uuid := p.resolver.placeholder(logicalID, "Ref")
+	e.UUID = &uuid
+	e.EventSourceArn = p.String("EventSourceArn")
+	e.FunctionArn = p.String("FunctionName")
+	e.BatchSize = p.Int32("BatchSize")
+	return e, nil
+}
+
+// lambdaPermissionFromTemplate names the statement of the permission after
+// its logical id, as templates are converted without importing.
+func lambdaPermissionFromTemplate(logicalID string, p Properties) (StackResource, error) {
+	return LambdaPermission{
+		LogicalID:        logicalID,
+		StatementID:      logicalID,
+		FunctionArn:      str(p.String("FunctionName")),
+		Action:           str(p.String("Action")),
+		Principal:        str(p.String("Principal")),
+		SourceArn:        p.String("SourceArn"),
+		SourceAccount:    p.String("SourceAccount"),
+		EventSourceToken: p.String("EventSourceToken"),
+	}, nil
+}
+
+func logGroupFromTemplate(logicalID string, p Properties) (StackResource, error) {
+	l := LogGroup{LogicalID: logicalID}
+	l.LogGroupName = p.Name("LogGroupName", logicalID)
+	arn := p.resolver.placeholder(logicalID, "Arn")
+	l.Arn = &arn
+	l.RetentionInDays = p.Int32("RetentionInDays")
+	return l, nil
+}
+
+func topicFromTemplate(logicalID string, p Properties) (StackResource, error) {
+	name := p.Name("TopicName", logicalID)
+	return Topic{
+		LogicalID:  logicalID,
+		Attributes: map[string]string{"TopicArn": templateArn("sns", *name)},
+		Name:       *name,
+	}, nil
+}
+
+func topicSubscriptionFromTemplate(logicalID string, p Properties) (StackResource, error) {
+	return TopicSubscription{
+		LogicalID: logicalID,
+		Attributes: map[string]string{
+			"SubscriptionArn": p.resolver.placeholder(logicalID, "Ref"),
+			"TopicArn":        str(p.String("TopicArn")),
+			"Protocol":        str(p.String("Protocol")),
+			"Endpoint":        str(p.String("Endpoint")),
+		},
+	}, nil
+}
+
+func queueFromTemplate(logicalID string, p Properties) (StackResource, error) {
+	name := p.Name("QueueName", logicalID)
+	q := Queue{
+		LogicalID:  logicalID,
+		URL:        p.resolver.placeholder(logicalID, "Ref"),
+		Attributes: map[string]string{"QueueArn": templateArn("sqs", *name)},
+		Name:       *name,
+	}
+	if policy := p.JSON("RedrivePolicy"); policy != nil {
+		q.Attributes["RedrivePolicy"] = *policy
+	}
+	return q, nil
+}
+
+// restApiFromTemplate converts a rest api along with the resources, methods,
+// authorizers, deployments and stages the template declares for it, which
+// are indexed so references to them resolve to their terraform resources.
+func restApiFromTemplate(logicalID string, p Properties) (StackResource, error) {
+	id := p.resolver.placeholder(logicalID, "Ref")
+	a := RestApi{LogicalID: logicalID}
+	a.Id = &id
+	a.Name = p.Name("Name", logicalID)
+	a.Description = p.String("Description")
+	a.BinaryMediaTypes = p.Strings("BinaryMediaTypes")
+	a.MinimumCompressionSize = p.Int32("MinimumCompressionSize")
+	a.DisableExecuteApiEndpoint = str(p.String("DisableExecuteApiEndpoint")) == "true"
+	a.Policy = p.JSON("Policy")
+	a.Body = p.JSON("Body")
+	if p.Has("BodyS3Location") {
+		log.WithField("logical_id", logicalID).Warn("unsupported rest api definition in s3, declare it as a Body")
+	}
+	if c, ok := p.Object("EndpointConfiguration"); ok {
+		a.EndpointConfiguration = &apigatewayTypes.EndpointConfiguration{}
+		for _, t := range c.Strings("Types") {
+			a.EndpointConfiguration.Types = append(a.EndpointConfiguration.Types, apigatewayTypes.EndpointType(t))
+		}
+	}
+
+	// the root resource exists with the api, and is referenced by its RootResourceId
+	root := p.resolver.placeholder(logicalID, "RootResourceId")
+	paths := map[string]string{root: "/"}
+	a.Resources = []apigatewayTypes.Resource{{Id: &root, ResourceMethods: map[string]apigatewayTypes.Method{}}}
+	children := p.resolver.referencing("AWS::ApiGateway::Resource", "RestApiId", logicalID)
+	parents := map[string]string{}
+	for _, c := range children {
+		id := p.resolver.placeholder(c.logicalID, "Ref")
+		parents[id] = str(c.properties.String("ParentId"))
+		a.Resources = append(a.Resources, apigatewayTypes.Resource{
+			Id:              &id,
+			ParentId:        c.properties.String("ParentId"),
+			PathPart:        c.properties.String("PathPart"),
+			ResourceMethods: map[string]apigatewayTypes.Method{},
+		})
+	}
+	var path func(id string, depth int) string
+	path = func(id string, depth int) string {
+		if p, has := paths[id]; has || depth > len(a.Resources) {
+			return p
+		}
+		parent := path(parents[id], depth+1)
+		for _, r := range a.Resources {
+			if *r.Id == id {
+				paths[id] = strings.TrimSuffix(parent, "/") + "/" + str(r.PathPart)
+			}
+		}
+		return paths[id]
+	}
+	for i := range a.Resources {
+		resourcePath := path(*a.Resources[i].Id, 0)
+		a.Resources[i].Path = &resourcePath
+	}
+	sort.Slice(a.Resources, func(i, j int) bool {
+		return str(a.Resources[i].Path) < str(a.Resources[j].Path)
+	})
+
+	for _, c := range p.resolver.referencing("AWS::ApiGateway::Method", "RestApiId", logicalID) {
+		resourceID, httpMethod := str(c.properties.String("ResourceId")), str(c.properties.String("HttpMethod"))
+		m := apigatewayTypes.Method{
+			HttpMethod:          &httpMethod,
+			AuthorizationType:   c.properties.String("AuthorizationType"),
+			AuthorizerId:        c.properties.String("AuthorizerId"),
+			AuthorizationScopes: c.properties.Strings("AuthorizationScopes"),
+			OperationName:       c.properties.String("OperationName"),
+			RequestModels:       c.properties.StringMap("RequestModels"),
+			RequestValidatorId:  c.properties.String("RequestValidatorId"),
+		}
+		if m.AuthorizationType == nil {
+			none := "NONE"
+			m.AuthorizationType = &none
+		}
+		if required := c.properties.String("ApiKeyRequired"); required != nil {
+			apiKeyRequired := *required == "true"
+			m.ApiKeyRequired = &apiKeyRequired
+		}
+		if params := c.properties.StringMap("RequestParameters"); len(params) > 0 {
+			m.RequestParameters = boolMap(params)
+		}
+		for _, r := range c.properties.Objects("MethodResponses") {
+			if m.MethodResponses == nil {
+				m.MethodResponses = map[string]apigatewayTypes.MethodResponse{}
+			}
+			statusCode := str(r.String("StatusCode"))
+			m.MethodResponses[statusCode] = apigatewayTypes.MethodResponse{
+				StatusCode:         &statusCode,
+				ResponseModels:     r.StringMap("ResponseModels"),
+				ResponseParameters: boolMap(r.StringMap("ResponseParameters")),
+			}
+		}
+		if i, ok := c.properties.Object("Integration"); ok {
+			m.MethodIntegration = &apigatewayTypes.Integration{
+				Type:                apigatewayTypes.IntegrationType(str(i.String("Type"))),
+				HttpMethod:          i.String("IntegrationHttpMethod"),
+				Uri:                 i.String("Uri"),
+				Credentials:         i.String("Credentials"),
+				ConnectionType:      apigatewayTypes.ConnectionType(str(i.String("ConnectionType"))),
+				ConnectionId:        i.String("ConnectionId"),
+				ContentHandling:     apigatewayTypes.ContentHandlingStrategy(str(i.String("ContentHandling"))),
+				PassthroughBehavior: i.String("PassthroughBehavior"),
+				RequestParameters:   i.StringMap("RequestParameters"),
+				RequestTemplates:    i.StringMap("RequestTemplates"),
+				CacheKeyParameters:  i.Strings("CacheKeyParameters"),
+				CacheNamespace:      i.String("CacheNamespace"),
+			}
+			if timeout := i.Int32("TimeoutInMillis"); timeout != nil {
+				m.MethodIntegration.TimeoutInMillis = *timeout
+			}
+			for _, r := range i.Objects("IntegrationResponses") {
+				if m.MethodIntegration.IntegrationResponses == nil {
+					m.MethodIntegration.IntegrationResponses = map[string]apigatewayTypes.IntegrationResponse{}
+				}
+				statusCode := str(r.String("StatusCode"))
+				m.MethodIntegration.IntegrationResponses[statusCode] = apigatewayTypes.IntegrationResponse{
+					StatusCode:         &statusCode,
+					SelectionPattern:   r.String("SelectionPattern"),
+					ResponseParameters: r.StringMap("ResponseParameters"),
+					ResponseTemplates:  r.StringMap("ResponseTemplates"),
+					ContentHandling:    apigatewayTypes.ContentHandlingStrategy(str(r.String("ContentHandling"))),
+				}
+			}
+		}
+
+		found := false
+		for _, r := range a.Resources {
+			if *r.Id == resourceID {
+				r.ResourceMethods[httpMethod] = m
+				found = true
+			}
+		}
+		if !found {
+			log.WithField("logical_id", c.logicalID).Warn("unable to find the resource of a method")
+		}
+	}
+
+	for _, c := range p.resolver.referencing("AWS::ApiGateway::Authorizer", "RestApiId", logicalID) {
+		id := p.resolver.placeholder(c.logicalID, "Ref")
+		a.Authorizers = append(a.Authorizers, apigatewayTypes.Authorizer{
+			Id:                           &id,
+			Name:                         c.properties.Name("Name", c.logicalID),
+			Type:                         apigatewayTypes.AuthorizerType(str(c.properties.String("Type"))),
+			AuthorizerUri:                c.properties.String("AuthorizerUri"),
+			AuthorizerCredentials:        c.properties.String("AuthorizerCredentials"),
+			IdentitySource:               c.properties.String("IdentitySource"),
+			IdentityValidationExpression: c.properties.String("IdentityValidationExpression"),
+			AuthorizerResultTtlInSeconds: c.properties.Int32("AuthorizerResultTtlInSeconds"),
+			ProviderARNs:                 c.properties.Strings("ProviderARNs"),
+		})
+	}
+
+	for _, c := range p.resolver.referencing("AWS::ApiGateway::Deployment", "RestApiId", logicalID) {
+		id := p.resolver.placeholder(c.logicalID, "Ref")
+		a.Deployments = append(a.Deployments, apigatewayTypes.Deployment{
+			Id:          &id,
+			Description: c.properties.String("Description"),
+		})
+		// a deployment with a StageName creates the stage
+		if stageName := c.properties.String("StageName"); stageName != nil {
+			a.Stages = append(a.Stages, apigatewayTypes.Stage{StageName: stageName, DeploymentId: &id})
+		}
+	}
+	for _, c := range p.resolver.referencing("AWS::ApiGateway::Stage", "RestApiId", logicalID) {
+		stage := apigatewayTypes.Stage{
+			StageName:      c.properties.String("StageName"),
+			DeploymentId:   c.properties.String("DeploymentId"),
+			Description:    c.properties.String("Description"),
+			Variables:      c.properties.StringMap("Variables"),
+			TracingEnabled: str(c.properties.String("TracingEnabled")) == "true",
+		}
+		a.Stages = append(a.Stages, stage)
+		p.resolver.children[p.resolver.placeholder(c.logicalID, "Ref")] = a.stage(stage)
+	}
+
+	for _, r := range a.Resources {
+		if str(r.Path) != "/" {
+			p.resolver.children[*r.Id] = a.resource(r)
+		}
+	}
+	for _, auth := range a.Authorizers {
+		p.resolver.children[*auth.Id] = a.authorizer(auth)
+	}
+	for _, d := range a.Deployments {
+		p.resolver.children[*d.Id] = a.deployment(d)
+	}
+	return a, nil
+}
+
+// boolMap converts a map of boolean properties resolved to strings.
+func boolMap(m map[string]string) map[string]bool {
+	bools := map[string]bool{}
+	for k, v := range m {
+		bools[k] = v == "true"
+	}
+	return bools
+}
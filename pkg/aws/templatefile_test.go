@@ -0,0 +1,170 @@
+package aws
+
+import (
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/cr-norton/tfconvert/pkg/codegen"
+	"github.com/cr-norton/tfconvert/pkg/types"
+)
+
+func TestLoadTemplateApiEvents(t *testing.T) {
+	stack, err := LoadTemplate([]byte(`
+Transform: AWS::Serverless-2016-10-31
+Resources:
+  Orders:
+    Type: AWS::Serverless::Function
+    Properties:
+      Handler: index.handler
+      Runtime: python3.9
+      CodeUri: .
+      Events:
+        List:
+          Type: Api
+          Properties: {Path: /orders, Method: get}
+        Get:
+          Type: Api
+          Properties: {Path: "/orders/{id}", Method: any}
+  Admin:
+    Type: AWS::Serverless::Function
+    Properties:
+      Handler: index.handler
+      Runtime: python3.9
+      CodeUri: .
+      Events:
+        Put:
+          Type: Api
+          Properties: {Path: "/orders/{id}", Method: put, RestApiId: !Ref AdminApi}
+  AdminApi:
+    Type: AWS::Serverless::Api
+    Properties:
+      StageName: live
+Outputs:
+  Resource:
+    Value: !Ref ServerlessRestApiOrdersIdResource
+`), types.Options{StackName: "shop"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	files := codegen.GenerateHCL(stack)
+	if err := codegen.CheckAddresses(files, stack.Resources()); err != nil {
+		t.Fatal(err)
+	}
+
+	space := regexp.MustCompile(`\s+`)
+	contains := func(file string, blocks ...string) {
+		t.Helper()
+		hcl := space.ReplaceAllString(files[file], " ")
+		for _, block := range blocks {
+			if !strings.Contains(hcl, space.ReplaceAllString(block, " ")) {
+				t.Errorf("%s doesn't contain %s\n%s", file, block, files[file])
+			}
+		}
+	}
+	contains("apigateway.tf",
+		`resource "aws_api_gateway_rest_api" "serverless_rest_api" { name = "shop-ServerlessRestApi"`,
+		`resource "aws_api_gateway_resource" "serverless_rest_api_orders" {
+			rest_api_id = aws_api_gateway_rest_api.serverless_rest_api.id
+			parent_id = aws_api_gateway_rest_api.serverless_rest_api.root_resource_id
+			path_part = "orders" }`,
+		`resource "aws_api_gateway_resource" "serverless_rest_api_orders_id" {
+			rest_api_id = aws_api_gateway_rest_api.serverless_rest_api.id
+			parent_id = aws_api_gateway_resource.serverless_rest_api_orders.id
+			path_part = "{id}" }`,
+		`resource "aws_api_gateway_method" "serverless_rest_api_orders_get" {
+			rest_api_id = aws_api_gateway_rest_api.serverless_rest_api.id
+			resource_id = aws_api_gateway_resource.serverless_rest_api_orders.id
+			http_method = "GET"
+			authorization = "NONE" }`,
+		`resource "aws_api_gateway_integration" "serverless_rest_api_orders_id_any" {
+			rest_api_id = aws_api_gateway_rest_api.serverless_rest_api.id
+			resource_id = aws_api_gateway_resource.serverless_rest_api_orders_id.id
+			http_method = aws_api_gateway_method.serverless_rest_api_orders_id_any.http_method
+			integration_http_method = "POST"
+			type = "AWS_PROXY"
+			uri = aws_lambda_function.orders.invoke_arn }`,
+		`resource "aws_api_gateway_stage" "serverless_rest_api_prod" {
+			rest_api_id = aws_api_gateway_rest_api.serverless_rest_api.id
+			deployment_id = aws_api_gateway_deployment.serverless_rest_api_prod.id
+			stage_name = "Prod"`,
+		`resource "aws_api_gateway_method" "admin_api_orders_id_put" {
+			rest_api_id = aws_api_gateway_rest_api.admin_api.id
+			resource_id = aws_api_gateway_resource.admin_api_orders_id.id
+			http_method = "PUT"`,
+		`resource "aws_api_gateway_stage" "admin_api_live" {
+			rest_api_id = aws_api_gateway_rest_api.admin_api.id
+			deployment_id = aws_api_gateway_deployment.admin_api_live.id
+			stage_name = "live"`,
+	)
+	contains("lambda.tf",
+		`resource "aws_lambda_permission" "orders_get_permission" {
+			statement_id = "OrdersGetPermission"
+			action = "lambda:InvokeFunction"
+			function_name = aws_lambda_function.orders.function_name
+			principal = "apigateway.amazonaws.com"
+			source_arn = "arn:aws:execute-api:${data.aws_region.current.name}:${data.aws_caller_identity.current.account_id}:${aws_api_gateway_rest_api.serverless_rest_api.id}/*/*/orders/*" }`,
+		`resource "aws_lambda_permission" "admin_put_permission" {`,
+	)
+
+	if res := stack.Lookup("${ServerlessRestApiOrdersIdResource}"); res == nil || res.Type != "aws_api_gateway_resource" {
+		t.Errorf("Lookup(${ServerlessRestApiOrdersIdResource}) = %v, want the aws_api_gateway_resource", res)
+	}
+}
+
+func TestLoadTemplateAutoPublishAlias(t *testing.T) {
+	stack, err := LoadTemplate([]byte(`
+Transform: AWS::Serverless-2016-10-31
+Parameters:
+  Concurrency:
+    Type: Number
+Resources:
+  Orders:
+    Type: AWS::Serverless::Function
+    Properties:
+      Handler: index.handler
+      Runtime: python3.9
+      CodeUri: .
+      AutoPublishAlias: live
+      ProvisionedConcurrencyConfig:
+        ProvisionedConcurrentExecutions: !Ref Concurrency
+      Events:
+        Jobs:
+          Type: SQS
+          Properties: {Queue: !GetAtt Jobs.Arn}
+  Jobs:
+    Type: AWS::SQS::Queue
+`), types.Options{StackName: "shop"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	files := codegen.GenerateHCL(stack)
+	if err := codegen.CheckAddresses(files, stack.Resources()); err != nil {
+		t.Fatal(err)
+	}
+
+	functions := stack.LambdaFunctions()
+	if len(functions) != 1 || len(functions[0].Versions) != 1 {
+		t.Fatalf("LambdaFunctions() = %v, want Orders with its version", functions)
+	}
+	space := regexp.MustCompile(`\s+`)
+	hcl := space.ReplaceAllString(files["lambda.tf"], " ")
+	for _, block := range []string{
+		`resource "aws_lambda_alias" "orders_aliaslive" {
+			name = "live"
+			function_name = aws_lambda_function.orders.function_name
+			function_version = aws_lambda_function.orders.version }`,
+		`resource "aws_lambda_provisioned_concurrency_config" "orders_aliaslive" {
+			function_name = aws_lambda_alias.orders_aliaslive.function_name
+			qualifier = aws_lambda_alias.orders_aliaslive.name
+			provisioned_concurrent_executions = var.concurrency }`,
+		`resource "aws_lambda_event_source_mapping" "orders_jobs" {
+			event_source_arn = aws_sqs_queue.jobs.arn
+			function_name = aws_lambda_alias.orders_aliaslive.arn }`,
+		`publish = true`,
+	} {
+		if !strings.Contains(hcl, space.ReplaceAllString(block, " ")) {
+			t.Errorf("lambda.tf doesn't contain %s\n%s", block, files["lambda.tf"])
+		}
+	}
+}
@@ -0,0 +1,122 @@
+package aws
+
+import (
+	"context"
+	"sync"
+
+	awsv2 "github.com/aws/aws-sdk-go-v2/aws"
+	awsmiddleware "github.com/aws/aws-sdk-go-v2/aws/middleware"
+	"github.com/aws/aws-sdk-go-v2/aws/retry"
+	"github.com/aws/smithy-go/middleware"
+	log "github.com/sirupsen/logrus"
+	"golang.org/x/time/rate"
+)
+
+// minRate is the slowest an adaptive limiter backs off to, in requests per second
+const minRate = 0.5
+
+// throttleCodes are the error codes aws services return when throttling
+var throttleCodes = retry.RetryableErrorCode{Codes: map[string]struct{}{
+	"Throttling":                             {},
+	"ThrottlingException":                    {},
+	"ThrottledException":                     {},
+	"RequestThrottledException":              {},
+	"TooManyRequestsException":               {},
+	"ProvisionedThroughputExceededException": {},
+	"TransactionInProgressException":         {},
+	"RequestLimitExceeded":                   {},
+	"BandwidthLimitExceeded":                 {},
+	"LimitExceededException":                 {},
+	"RequestThrottled":                       {},
+	"SlowDown":                               {},
+}}
+
+// adaptiveLimiter rate limits requests per aws service. A throttled request
+// halves the rate of its service and every successful request raises it back
+// towards the configured maximum.
+type adaptiveLimiter struct {
+	mu       sync.Mutex
+	max      rate.Limit
+	limiters map[string]*rate.Limiter
+}
+
+func newAdaptiveLimiter(max float64) *adaptiveLimiter {
+	return &adaptiveLimiter{
+		max:      rate.Limit(max),
+		limiters: map[string]*rate.Limiter{},
+	}
+}
+
+func (a *adaptiveLimiter) limiter(service string) *rate.Limiter {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	l, has := a.limiters[service]
+	if !has {
+		l = rate.NewLimiter(a.max, 1)
+		a.limiters[service] = l
+	}
+	return l
+}
+
+func (a *adaptiveLimiter) throttled(service string) {
+	l := a.limiter(service)
+	limit := l.Limit() / 2
+	if limit < minRate {
+		limit = minRate
+	}
+	l.SetLimit(limit)
+	log.WithFields(log.Fields{
+		"service": service,
+		"rate":    float64(limit),
+	}).Debug("request throttled, reducing rate")
+}
+
+func (a *adaptiveLimiter) succeeded(service string) {
+	l := a.limiter(service)
+	if limit := l.Limit() + a.max/20; limit < a.max {
+		l.SetLimit(limit)
+	} else {
+		l.SetLimit(a.max)
+	}
+}
+
+// middleware waits on the limiter of the service before every attempt, so
+// retries are limited as well.
+func (a *adaptiveLimiter) middleware(stack *middleware.Stack) error {
+	return stack.Finalize.Insert(middleware.FinalizeMiddlewareFunc("AdaptiveRateLimit",
+		func(ctx context.Context, in middleware.FinalizeInput, next middleware.FinalizeHandler) (middleware.FinalizeOutput, middleware.Metadata, error) {
+			service := awsmiddleware.GetServiceID(ctx)
+			if err := a.limiter(service).Wait(ctx); err != nil {
+				return middleware.FinalizeOutput{}, middleware.Metadata{}, err
+			}
+
+			out, md, err := next.HandleFinalize(ctx, in)
+			if err != nil && throttleCodes.IsErrorRetryable(err) == awsv2.TrueTernary {
+				a.throttled(service)
+			} else if err == nil {
+				a.succeeded(service)
+			}
+			return out, md, err
+		}), "Retry", middleware.After)
+}
+
+// newRetryer retries throttling and transient errors with exponential backoff.
+// The adaptive limiter replaces the retry quota of the standard retryer, which
+// would otherwise give up on a heavily throttled account.
+func newRetryer(maxRetries int) func() awsv2.Retryer {
+	return func() awsv2.Retryer {
+		return retry.NewStandard(func(o *retry.StandardOptions) {
+			o.MaxAttempts = maxRetries + 1
+			o.RateLimiter = noRetryQuota{}
+			o.Retryables = append([]retry.IsErrorRetryable{throttleCodes}, o.Retryables...)
+		})
+	}
+}
+
+type noRetryQuota struct{}
+
+func (noRetryQuota) GetToken(ctx context.Context, cost uint) (func() error, error) {
+	return func() error { return nil }, nil
+}
+
+func (noRetryQuota) AddTokens(uint) error { return nil }
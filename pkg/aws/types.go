@@ -3,7 +3,9 @@ package aws
 import (
 	"encoding/json"
 	"fmt"
+	"sort"
 	"strings"
+	"unicode"
 
 	logs "github.com/aws/aws-sdk-go-v2/service/cloudwatchlogs/types"
 	dynamodb "github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
@@ -13,8 +15,6 @@ import (
 	"github.com/cr-norton/tfconvert/pkg/types"
 )
 
-// todo refactor handling
-
 type DynamoTable struct {
 	LogicalID string
 	dynamodb.TableDescription
@@ -53,6 +53,100 @@ func (r Role) Resource() types.Resource {
 	}
 }
 
+// ChildResources returns the inline policies of the role and the
+// attachments of its managed policies, which terraform manages as separate
+// resources.
+func (r Role) ChildResources() []types.Resource {
+	resources := []types.Resource{}
+	for _, p := range r.inlinePolicies() {
+		resources = append(resources, p.Resource)
+	}
+	for _, a := range r.policyAttachments() {
+		resources = append(resources, a.Resource)
+	}
+	return resources
+}
+
+// rolePolicy is an inline policy of a role.
+type rolePolicy struct {
+	types.Resource
+	Name string
+}
+
+// inlinePolicies returns the inline policies of the role, sorted by name.
+func (r Role) inlinePolicies() []rolePolicy {
+	names := []string{}
+	for name := range r.PolicyDocuments {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	policies := []rolePolicy{}
+	for _, name := range names {
+		policies = append(policies, rolePolicy{
+			Resource: types.Resource{
+				Type:       "aws_iam_role_policy",
+				Identifier: r.LogicalID + "_" + name,
+				ImportKey:  fmt.Sprintf("%s:%s", *r.Role.RoleName, name),
+				OutputKey:  "id",
+			},
+			Name: name,
+		})
+	}
+	return policies
+}
+
+// identifierPart keeps the letters, digits, underscores and dashes of a name
+// to make it part of an identifier.
+func identifierPart(name string) string {
+	return strings.Map(func(c rune) rune {
+		if c == '_' || c == '-' || unicode.IsLetter(c) || unicode.IsDigit(c) {
+			return c
+		}
+		return -1
+	}, name)
+}
+
+// rolePolicyAttachment attaches a managed policy to a role.
+type rolePolicyAttachment struct {
+	types.Resource
+	PolicyArn string
+}
+
+// policyAttachments returns the attachments of the managed policies of the
+// role, named after the policies. Policies are referenced by arn in
+// templates, so their name is the last part of it.
+func (r Role) policyAttachments() []rolePolicyAttachment {
+	attachments := []rolePolicyAttachment{}
+	seen := map[string]bool{}
+	for _, p := range r.AttachedPolicies {
+		arn := str(p.Arn)
+		name := str(p.PolicyName)
+		if name == "" {
+			name = arn[strings.LastIndexAny(arn, ":/")+1:]
+		}
+		name = identifierPart(name)
+		identifier := r.LogicalID + "_" + name
+		for i := 2; seen[identifier]; i++ {
+			identifier = fmt.Sprintf("%s_%s_%d", r.LogicalID, name, i)
+		}
+		seen[identifier] = true
+		attachments = append(attachments, rolePolicyAttachment{
+			Resource: types.Resource{
+				Type:       "aws_iam_role_policy_attachment",
+				Identifier: identifier,
+				ImportKey:  fmt.Sprintf("%s/%s", *r.Role.RoleName, arn),
+				OutputKey:  "id",
+			},
+			PolicyArn: arn,
+		})
+	}
+	sort.Slice(attachments, func(i, j int) bool {
+		return attachments[i].Identifier < attachments[j].Identifier
+	})
+	return attachments
+}
+
 type FirehoseDeliveryStream struct {
 	LogicalID string
 	firehose.DeliveryStreamDescription
@@ -74,11 +168,20 @@ func (f FirehoseDeliveryStream) Resource() types.Resource {
 type LambdaFunctionConfiguration struct {
 	LogicalID string
 	lambda.FunctionConfiguration
+	// Versions are the versions of the function published by the stack
+	Versions []LambdaVersion
+	// LatestVersion is the latest version published of the function
+	LatestVersion string
+	// ImageUri is the image of functions packaged as container images
+	ImageUri *string
+	// ReservedConcurrentExecutions is the concurrency reserved for the
+	// function, if any
+	ReservedConcurrentExecutions *int32
 }
 
 func (l LambdaFunctionConfiguration) Resource() types.Resource {
 	return types.Resource{
-		Type:       "lambda_function",
+		Type:       "aws_lambda_function",
 		Identifier: l.LogicalID,
 		ImportKey:  *l.FunctionName,
 		OutputKey:  "arn",
@@ -89,6 +192,32 @@ func (l LambdaFunctionConfiguration) Key() string {
 	return *l.FunctionConfiguration.FunctionArn
 }
 
+// Keys returns the arn of the latest version published by the stack, which
+// references the qualified_arn of the function.
+func (l LambdaFunctionConfiguration) Keys() map[string]types.Resource {
+	keys := map[string]types.Resource{}
+	for _, v := range l.Versions {
+		if v.Version == l.LatestVersion {
+			res := l.Resource()
+			res.OutputKey = "qualified_arn"
+			keys[v.FunctionArn] = res
+		}
+	}
+	return keys
+}
+
+// ChildResources returns the provisioned concurrency of the versions of the
+// function, which terraform manages as separate resources.
+func (l LambdaFunctionConfiguration) ChildResources() []types.Resource {
+	resources := []types.Resource{}
+	for _, v := range l.Versions {
+		if v.ProvisionedConcurrency != nil {
+			resources = append(resources, v.provisionedConcurrency())
+		}
+	}
+	return resources
+}
+
 type LambdaEventSource struct {
 	LogicalID string
 	lambda.EventSourceMappingConfiguration
@@ -96,10 +225,10 @@ type LambdaEventSource struct {
 
 func (l LambdaEventSource) Resource() types.Resource {
 	return types.Resource{
-		Type:       "lambda_event_source_mapping",
+		Type:       "aws_lambda_event_source_mapping",
 		Identifier: l.LogicalID,
 		ImportKey:  *l.UUID,
-		OutputKey:  "arn",
+		OutputKey:  "uuid",
 	}
 }
 
@@ -108,6 +237,10 @@ type LogGroup struct {
 	logs.LogGroup
 }
 
+func (l LogGroup) Key() string {
+	return *l.Arn
+}
+
 func (l LogGroup) Resource() types.Resource {
 	return types.Resource{
 		Type:       "aws_cloudwatch_log_group",
@@ -120,6 +253,9 @@ func (l LogGroup) Resource() types.Resource {
 type Topic struct {
 	LogicalID  string
 	Attributes map[string]string
+	// Name is the name of a topic declared in a template file, which can't be
+	// told from its arn when it's built from references
+	Name string
 }
 
 func (t Topic) Key() string {
@@ -136,6 +272,9 @@ func (t Topic) Resource() types.Resource {
 }
 
 func (t Topic) TopicName() string {
+	if t.Name != "" {
+		return t.Name
+	}
 	s := strings.Split(t.Attributes["TopicArn"], ":")
 	return s[len(s)-1]
 }
@@ -145,9 +284,13 @@ type TopicSubscription struct {
 	Attributes map[string]string
 }
 
+func (t TopicSubscription) Key() string {
+	return t.Attributes["SubscriptionArn"]
+}
+
 func (t TopicSubscription) Resource() types.Resource {
 	return types.Resource{
-		Type:       "sns_topic_subscription",
+		Type:       "aws_sns_topic_subscription",
 		Identifier: t.LogicalID,
 		ImportKey:  t.Attributes["SubscriptionArn"],
 		OutputKey:  "arn",
@@ -156,7 +299,11 @@ func (t TopicSubscription) Resource() types.Resource {
 
 type Queue struct {
 	LogicalID  string
+	URL        string
 	Attributes map[string]string
+	// Name is the name of a queue declared in a template file, which can't be
+	// told from its arn when it's built from references
+	Name string
 }
 
 func (q Queue) Key() string {
@@ -173,11 +320,17 @@ func (q Queue) Resource() types.Resource {
 }
 
 func (q Queue) QueueName() string {
+	if q.Name != "" {
+		return q.Name
+	}
 	s := strings.Split(q.Attributes["QueueArn"], ":")
 	return s[len(s)-1]
 }
 
 func (q Queue) QueueUrl() string {
+	if q.URL != "" {
+		return q.URL
+	}
 	s := strings.Split(q.Attributes["QueueArn"], ":")
 	region, account, name := s[3], s[4], s[5]
 	return fmt.Sprintf("https://%s.queue.amazonaws.com/%s/%s", region, account, name)
@@ -0,0 +1,456 @@
+package cfn
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// ServerlessTransform is the transform of SAM templates.
+const ServerlessTransform = "AWS::Serverless-2016-10-31"
+
+// executionPolicies are the managed policies SAM attaches to the role of a
+// function for the events polled by its event source mappings.
+var executionPolicies = map[string]string{
+	"SQS":      "arn:aws:iam::aws:policy/service-role/AWSLambdaSQSQueueExecutionRole",
+	"DynamoDB": "arn:aws:iam::aws:policy/service-role/AWSLambdaDynamoDBExecutionRole",
+	"Kinesis":  "arn:aws:iam::aws:policy/service-role/AWSLambdaKinesisExecutionRole",
+}
+
+// eventSources are the properties holding the source of polled events.
+var eventSources = map[string]string{
+	"SQS":      "Queue",
+	"DynamoDB": "Stream",
+	"Kinesis":  "Stream",
+}
+
+// Serverless reports whether the template uses the SAM transform.
+func (t Template) Serverless() bool {
+	switch transform := t.Transform.(type) {
+	case string:
+		return transform == ServerlessTransform
+	case []interface{}:
+		for _, tr := range transform {
+			if tr == ServerlessTransform {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// ExpandServerless replaces the AWS::Serverless resources of the template
+// with the resources the SAM transform generates for them, keeping their
+// logical ids so references to them still resolve. Functions generate their
+// role, named <Function>Role, and the resources of their events, named
+// <Function><Event>, along with the <Function><Event>Permission of topics and
+// apis. Api events declare the resources and methods of their api rather than
+// a definition body, and those without a RestApiId use the ServerlessRestApi
+// SAM generates. Functions with an AutoPublishAlias also generate their
+// <Function>Version<hash> and <Function>Alias<Alias>, which their events
+// invoke in place of the function.
+func (t *Template) ExpandServerless() {
+	globals, _ := t.Globals["Function"].(map[string]interface{})
+	for _, id := range t.LogicalIDs() {
+		r := t.Resources[id]
+		switch r.Type {
+		case "AWS::Serverless::Function":
+			t.expandFunction(id, withGlobals(r.Properties, globals))
+		case "AWS::Serverless::SimpleTable":
+			t.expandSimpleTable(id, r.Properties)
+		case "AWS::Serverless::Api":
+			t.expandApi(id, r.Properties)
+		case "AWS::Serverless::LayerVersion":
+			t.expandLayerVersion(id, r.Properties)
+		default:
+			if strings.HasPrefix(r.Type, "AWS::Serverless::") {
+				log.WithFields(log.Fields{
+					"resource_type": r.Type,
+					"logical_id":    id,
+				}).Warn("unsupported serverless resource")
+				delete(t.Resources, id)
+			}
+		}
+	}
+	t.Transform = nil
+	t.Globals = nil
+}
+
+func withGlobals(properties map[string]interface{}, globals map[string]interface{}) map[string]interface{} {
+	merged := map[string]interface{}{}
+	for k, v := range globals {
+		merged[k] = v
+	}
+	for k, v := range properties {
+		merged[k] = v
+	}
+	return merged
+}
+
+func (t *Template) expandFunction(id string, p map[string]interface{}) {
+	function := map[string]interface{}{}
+	for _, name := range []string{"FunctionName", "Handler", "Runtime", "MemorySize", "Timeout", "Environment", "Description", "Layers", "Tags",
+		"Architectures", "EphemeralStorage", "FileSystemConfigs", "ImageConfig", "KmsKeyArn", "PackageType", "ReservedConcurrentExecutions", "VpcConfig"} {
+		if v, has := p[name]; has {
+			function[name] = v
+		}
+	}
+	if v, has := p["ImageUri"]; has {
+		function["Code"] = map[string]interface{}{"ImageUri": v}
+	}
+	if v, has := p["Tracing"]; has {
+		function["TracingConfig"] = map[string]interface{}{"Mode": v}
+	}
+	if dlq, ok := p["DeadLetterQueue"].(map[string]interface{}); ok {
+		function["DeadLetterConfig"] = map[string]interface{}{"TargetArn": dlq["TargetArn"]}
+	}
+
+	// events invoke the alias of functions publishing one
+	invoked := id
+	if alias, ok := p["AutoPublishAlias"].(string); ok {
+		invoked = t.expandAlias(id, alias, function, p)
+	}
+	target := map[string]interface{}{"Ref": invoked}
+	targetArn := map[string]interface{}{"Fn::GetAtt": []interface{}{id, "Arn"}}
+	if invoked != id {
+		targetArn = target
+	}
+
+	events, _ := p["Events"].(map[string]interface{})
+	names := []string{}
+	for name := range events {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	managed := []interface{}{"arn:aws:iam::aws:policy/service-role/AWSLambdaBasicExecutionRole"}
+	for _, name := range names {
+		event, _ := events[name].(map[string]interface{})
+		eventType, _ := event["Type"].(string)
+		properties, _ := event["Properties"].(map[string]interface{})
+		switch eventType {
+		case "SQS", "DynamoDB", "Kinesis":
+			mapping := map[string]interface{}{
+				"EventSourceArn": properties[eventSources[eventType]],
+				"FunctionName":   target,
+			}
+			for _, k := range []string{"BatchSize", "StartingPosition", "Enabled"} {
+				if v, has := properties[k]; has {
+					mapping[k] = v
+				}
+			}
+			t.Resources[id+name] = Resource{Type: "AWS::Lambda::EventSourceMapping", Properties: mapping}
+			managed = append(managed, executionPolicies[eventType])
+		case "Api":
+			t.expandApiEvent(id, invoked, name, properties)
+		case "SNS":
+			t.Resources[id+name] = Resource{Type: "AWS::SNS::Subscription", Properties: map[string]interface{}{
+				"TopicArn": properties["Topic"],
+				"Protocol": "lambda",
+				"Endpoint": targetArn,
+			}}
+			t.Resources[id+name+"Permission"] = Resource{Type: "AWS::Lambda::Permission", Properties: map[string]interface{}{
+				"Action":       "lambda:InvokeFunction",
+				"FunctionName": target,
+				"Principal":    "sns.amazonaws.com",
+				"SourceArn":    properties["Topic"],
+			}}
+		default:
+			log.WithFields(log.Fields{
+				"logical_id": id,
+				"event":      name,
+				"event_type": eventType,
+			}).Warn("unsupported serverless function event")
+		}
+	}
+
+	if role, has := p["Role"]; has {
+		function["Role"] = role
+	} else {
+		role := map[string]interface{}{
+			"AssumeRolePolicyDocument": map[string]interface{}{
+				"Version": "2012-10-17",
+				"Statement": []interface{}{map[string]interface{}{
+					"Effect":    "Allow",
+					"Action":    []interface{}{"sts:AssumeRole"},
+					"Principal": map[string]interface{}{"Service": []interface{}{"lambda.amazonaws.com"}},
+				}},
+			},
+		}
+		inline := []interface{}{}
+		for _, policy := range policies(p["Policies"]) {
+			switch v := policy.(type) {
+			case string:
+				if !strings.HasPrefix(v, "arn:") {
+					v = "arn:aws:iam::aws:policy/" + v
+				}
+				managed = append(managed, v)
+			case map[string]interface{}:
+				if _, has := v["Statement"]; !has {
+					log.WithField("logical_id", id).Warn("unsupported serverless policy template")
+					continue
+				}
+				inline = append(inline, map[string]interface{}{
+					"PolicyName":     id + "RolePolicy" + strconv.Itoa(len(inline)),
+					"PolicyDocument": v,
+				})
+			default:
+				managed = append(managed, v)
+			}
+		}
+		role["ManagedPolicyArns"] = managed
+		if len(inline) > 0 {
+			role["Policies"] = inline
+		}
+		t.Resources[id+"Role"] = Resource{Type: "AWS::IAM::Role", Properties: role}
+		function["Role"] = map[string]interface{}{"Fn::GetAtt": []interface{}{id + "Role", "Arn"}}
+	}
+
+	t.Resources[id] = Resource{Type: "AWS::Lambda::Function", Properties: function}
+}
+
+// expandAlias generates the version SAM publishes for a function with an
+// AutoPublishAlias, named after a hash of the function so a changed function
+// publishes a new version, and the alias of that version, returning the
+// logical id of the alias.
+func (t *Template) expandAlias(id string, alias string, function map[string]interface{}, p map[string]interface{}) string {
+	body, _ := json.Marshal(function)
+	hash := sha256.Sum256(body)
+	versionID := id + "Version" + hex.EncodeToString(hash[:])[:10]
+	version := map[string]interface{}{"FunctionName": map[string]interface{}{"Ref": id}}
+	if v, has := p["VersionDescription"]; has {
+		version["Description"] = v
+	}
+	t.Resources[versionID] = Resource{Type: "AWS::Lambda::Version", Properties: version}
+
+	aliasID := id + "Alias"
+	for _, c := range alias {
+		if unicode.IsLetter(c) || unicode.IsDigit(c) {
+			aliasID += string(c)
+		}
+	}
+	properties := map[string]interface{}{
+		"Name":            alias,
+		"FunctionName":    map[string]interface{}{"Ref": id},
+		"FunctionVersion": map[string]interface{}{"Fn::GetAtt": []interface{}{versionID, "Version"}},
+	}
+	if v, has := p["ProvisionedConcurrencyConfig"]; has {
+		properties["ProvisionedConcurrencyConfig"] = v
+	}
+	if _, has := p["DeploymentPreference"]; has {
+		log.WithField("logical_id", id).Warn("unsupported serverless deployment preference")
+	}
+	t.Resources[aliasID] = Resource{Type: "AWS::Lambda::Alias", Properties: properties}
+	return aliasID
+}
+
+// policies returns the Policies of a function, which may be a single policy.
+func policies(v interface{}) []interface{} {
+	switch p := v.(type) {
+	case nil:
+		return nil
+	case []interface{}:
+		return p
+	}
+	return []interface{}{v}
+}
+
+func (t *Template) expandSimpleTable(id string, p map[string]interface{}) {
+	key := map[string]interface{}{"Name": "id", "Type": "String"}
+	if pk, ok := p["PrimaryKey"].(map[string]interface{}); ok {
+		key = pk
+	}
+	attributeTypes := map[interface{}]string{"String": "S", "Number": "N", "Binary": "B"}
+	table := map[string]interface{}{
+		"AttributeDefinitions": []interface{}{map[string]interface{}{"AttributeName": key["Name"], "AttributeType": attributeTypes[key["Type"]]}},
+		"KeySchema":            []interface{}{map[string]interface{}{"AttributeName": key["Name"], "KeyType": "HASH"}},
+	}
+	if throughput, has := p["ProvisionedThroughput"]; has {
+		table["ProvisionedThroughput"] = throughput
+	} else {
+		table["BillingMode"] = "PAY_PER_REQUEST"
+	}
+	for _, name := range []string{"TableName", "SSESpecification", "Tags"} {
+		if v, has := p[name]; has {
+			table[name] = v
+		}
+	}
+	t.Resources[id] = Resource{Type: "AWS::DynamoDB::Table", Properties: table}
+}
+
+func (t *Template) expandLayerVersion(id string, p map[string]interface{}) {
+	layer := map[string]interface{}{}
+	for _, name := range []string{"LayerName", "Description", "CompatibleRuntimes", "LicenseInfo"} {
+		if v, has := p[name]; has {
+			layer[name] = v
+		}
+	}
+	if uri, has := p["ContentUri"]; has {
+		layer["Content"] = uri
+	}
+	t.Resources[id] = Resource{Type: "AWS::Lambda::LayerVersion", Properties: layer}
+}
+
+// expandApi generates the rest api of an Api, its deployment, named
+// <Api>Deployment, and its stage, named <Api><StageName>Stage.
+func (t *Template) expandApi(id string, p map[string]interface{}) {
+	api := map[string]interface{}{}
+	for _, name := range []string{"Name", "Description", "BinaryMediaTypes", "MinimumCompressionSize"} {
+		if v, has := p[name]; has {
+			api[name] = v
+		}
+	}
+	// the EndpointConfiguration of SAM is a type, or an object with a Type
+	switch c := p["EndpointConfiguration"].(type) {
+	case string:
+		api["EndpointConfiguration"] = map[string]interface{}{"Types": []interface{}{c}}
+	case map[string]interface{}:
+		if _, _, ok := Intrinsic(c); ok {
+			api["EndpointConfiguration"] = map[string]interface{}{"Types": []interface{}{c}}
+		} else if endpointType, has := c["Type"]; has {
+			api["EndpointConfiguration"] = map[string]interface{}{"Types": []interface{}{endpointType}}
+		}
+	}
+	if body, has := p["DefinitionBody"]; has {
+		api["Body"] = body
+	}
+	if uri, has := p["DefinitionUri"]; has {
+		api["BodyS3Location"] = uri
+	}
+	t.Resources[id] = Resource{Type: "AWS::ApiGateway::RestApi", Properties: api}
+
+	ref := map[string]interface{}{"Ref": id}
+	t.Resources[id+"Deployment"] = Resource{Type: "AWS::ApiGateway::Deployment", Properties: map[string]interface{}{
+		"RestApiId": ref,
+	}}
+
+	stageName, _ := p["StageName"].(string)
+	stage := map[string]interface{}{
+		"RestApiId":    ref,
+		"DeploymentId": map[string]interface{}{"Ref": id + "Deployment"},
+		"StageName":    p["StageName"],
+	}
+	if variables, has := p["Variables"]; has {
+		stage["Variables"] = variables
+	}
+	t.Resources[id+stageName+"Stage"] = Resource{Type: "AWS::ApiGateway::Stage", Properties: stage}
+}
+
+// implicitApi is the api SAM generates for the Api events of functions that
+// don't reference one.
+const implicitApi = "ServerlessRestApi"
+
+// expandApiEvent generates the resources of the path of an Api event, named
+// <Api><Path>Resource, its method, named <Api><Path><Method>, and the
+// <Function><Event>Permission of the api to invoke the function, or the
+// invoked alias of the function. Apis with a definition body already declare
+// their methods, so only the permission is generated for them.
+func (t *Template) expandApiEvent(function string, invoked string, event string, p map[string]interface{}) {
+	api := implicitApi
+	if ref, ok := Ref(p["RestApiId"]); ok {
+		api = ref
+	} else if _, has := t.Resources[implicitApi]; !has {
+		t.expandApi(implicitApi, map[string]interface{}{"StageName": "Prod"})
+	}
+	path, _ := p["Path"].(string)
+	method, _ := p["Method"].(string)
+	method = strings.ToUpper(method)
+
+	// methods and path parameters match any value in the arn of the api
+	sourceMethod := method
+	if method == "ANY" {
+		sourceMethod = "*"
+	}
+	invokedArn := invoked
+	if invoked == function {
+		invokedArn = function + ".Arn"
+	}
+	sourcePath := strings.Split(path, "/")
+	for i, part := range sourcePath {
+		if strings.HasPrefix(part, "{") {
+			sourcePath[i] = "*"
+		}
+	}
+	t.Resources[function+event+"Permission"] = Resource{Type: "AWS::Lambda::Permission", Properties: map[string]interface{}{
+		"Action":       "lambda:InvokeFunction",
+		"FunctionName": map[string]interface{}{"Ref": invoked},
+		"Principal":    "apigateway.amazonaws.com",
+		"SourceArn": map[string]interface{}{
+			"Fn::Sub": "arn:aws:execute-api:${AWS::Region}:${AWS::AccountId}:${" + api + "}/*/" + sourceMethod + strings.Join(sourcePath, "/"),
+		},
+	}}
+
+	if r, has := t.Resources[api]; has {
+		if _, hasBody := r.Properties["DefinitionBody"]; hasBody {
+			return
+		}
+		if _, hasBody := r.Properties["Body"]; hasBody {
+			return
+		}
+	}
+
+	parent := map[string]interface{}{"Fn::GetAtt": []interface{}{api, "RootResourceId"}}
+	resourceID := api
+	for _, part := range strings.Split(strings.Trim(path, "/"), "/") {
+		if part == "" {
+			continue
+		}
+		resourceID = t.apiResourceID(resourceID, part, parent)
+		t.Resources[resourceID+"Resource"] = Resource{Type: "AWS::ApiGateway::Resource", Properties: map[string]interface{}{
+			"RestApiId": map[string]interface{}{"Ref": api},
+			"ParentId":  parent,
+			"PathPart":  part,
+		}}
+		parent = map[string]interface{}{"Ref": resourceID + "Resource"}
+	}
+
+	t.Resources[resourceID+logicalIDPart(strings.ToLower(method))] = Resource{Type: "AWS::ApiGateway::Method", Properties: map[string]interface{}{
+		"RestApiId":         map[string]interface{}{"Ref": api},
+		"ResourceId":        parent,
+		"HttpMethod":        method,
+		"AuthorizationType": "NONE",
+		"Integration": map[string]interface{}{
+			"Type":                  "AWS_PROXY",
+			"IntegrationHttpMethod": "POST",
+			"Uri": map[string]interface{}{
+				"Fn::Sub": "arn:aws:apigateway:${AWS::Region}:lambda:path/2015-03-31/functions/${" + invokedArn + "}/invocations",
+			},
+		},
+	}}
+}
+
+// apiResourceID returns the logical id, without its Resource suffix, of the
+// resource of a path part under a parent. Parts that only differ by their
+// punctuation, such as {id} and id, are numbered.
+func (t *Template) apiResourceID(parentID string, part string, parent map[string]interface{}) string {
+	base := parentID + logicalIDPart(part)
+	id := base
+	for i := 2; ; i++ {
+		r, has := t.Resources[id+"Resource"]
+		if !has || r.Properties["PathPart"] == part && reflect.DeepEqual(r.Properties["ParentId"], parent) {
+			return id
+		}
+		id = base + strconv.Itoa(i)
+	}
+}
+
+// logicalIDPart capitalizes the letters and digits of a name, e.g. Id for {id}.
+func logicalIDPart(name string) string {
+	part := ""
+	for _, c := range name {
+		if unicode.IsLetter(c) || unicode.IsDigit(c) {
+			part += string(c)
+		}
+	}
+	if part == "" {
+		return part
+	}
+	return strings.ToUpper(part[:1]) + part[1:]
+}
@@ -0,0 +1,267 @@
+// Package cfn parses CloudFormation templates in JSON or YAML, including the
+// short form of intrinsic functions such as !Ref and !GetAtt.
+package cfn
+
+import (
+	"encoding/json"
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+	"gopkg.in/yaml.v3"
+)
+
+// Template is a parsed CloudFormation template. Intrinsic functions are
+// always in their long form, e.g. {"Fn::GetAtt": ["Queue", "Arn"]}.
+type Template struct {
+	Transform  interface{}            `json:"Transform,omitempty"`
+	Globals    map[string]interface{} `json:"Globals,omitempty"`
+	Parameters map[string]Parameter   `json:"Parameters,omitempty"`
+	Resources  map[string]Resource    `json:"Resources"`
+	Outputs    map[string]Output      `json:"Outputs,omitempty"`
+}
+
+// Parameter declares a parameter of the template.
+type Parameter struct {
+	Type        string      `json:"Type"`
+	Default     interface{} `json:"Default,omitempty"`
+	Description string      `json:"Description,omitempty"`
+	NoEcho      interface{} `json:"NoEcho,omitempty"`
+}
+
+// Resource declares a resource of the template.
+type Resource struct {
+	Type       string                 `json:"Type"`
+	Properties map[string]interface{} `json:"Properties,omitempty"`
+}
+
+// Output declares an output of the template.
+type Output struct {
+	Value       interface{} `json:"Value"`
+	Description string      `json:"Description,omitempty"`
+	Export      *Export     `json:"Export,omitempty"`
+}
+
+// Export is the export of an output.
+type Export struct {
+	Name interface{} `json:"Name"`
+}
+
+// Parse parses a JSON or YAML template.
+func Parse(body []byte) (*Template, error) {
+	var node yaml.Node
+	if err := yaml.Unmarshal(body, &node); err != nil {
+		return nil, errors.Wrap(err, "unable to parse template")
+	}
+	value, err := convert(&node)
+	if err != nil {
+		return nil, errors.Wrap(err, "unable to parse template")
+	}
+
+	bytes, err := json.Marshal(value)
+	if err != nil {
+		return nil, errors.Wrap(err, "unable to parse template")
+	}
+	var template Template
+	if err := json.Unmarshal(bytes, &template); err != nil {
+		return nil, errors.Wrap(err, "unable to parse template")
+	}
+	return &template, nil
+}
+
+// convert converts a yaml node to plain values, expanding the short form tags
+// of intrinsic functions.
+func convert(node *yaml.Node) (interface{}, error) {
+	var value interface{}
+	switch node.Kind {
+	case yaml.DocumentNode:
+		if len(node.Content) == 0 {
+			return nil, nil
+		}
+		return convert(node.Content[0])
+	case yaml.AliasNode:
+		return convert(node.Alias)
+	case yaml.MappingNode:
+		m := map[string]interface{}{}
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			v, err := convert(node.Content[i+1])
+			if err != nil {
+				return nil, err
+			}
+			m[node.Content[i].Value] = v
+		}
+		value = m
+	case yaml.SequenceNode:
+		l := []interface{}{}
+		for _, n := range node.Content {
+			v, err := convert(n)
+			if err != nil {
+				return nil, err
+			}
+			l = append(l, v)
+		}
+		value = l
+	case yaml.ScalarNode:
+		switch node.ShortTag() {
+		case "!!int", "!!float", "!!bool", "!!null":
+			if err := node.Decode(&value); err != nil {
+				return nil, err
+			}
+		default:
+			value = node.Value
+		}
+	}
+
+	if !strings.HasPrefix(node.Tag, "!") || strings.HasPrefix(node.Tag, "!!") {
+		return value, nil
+	}
+	name := strings.TrimPrefix(node.Tag, "!")
+	if name == "Ref" || name == "Condition" {
+		return map[string]interface{}{name: value}, nil
+	}
+	if s, ok := value.(string); ok && name == "GetAtt" {
+		// the short form of GetAtt is a single string, resource.attribute
+		parts := strings.SplitN(s, ".", 2)
+		l := []interface{}{}
+		for _, p := range parts {
+			l = append(l, p)
+		}
+		value = l
+	}
+	return map[string]interface{}{"Fn::" + name: value}, nil
+}
+
+// Intrinsic returns the name and argument of an intrinsic function.
+func Intrinsic(v interface{}) (string, interface{}, bool) {
+	m, ok := v.(map[string]interface{})
+	if !ok || len(m) != 1 {
+		return "", nil, false
+	}
+	for name, arg := range m {
+		if name == "Ref" || name == "Condition" || strings.HasPrefix(name, "Fn::") {
+			return name, arg, true
+		}
+	}
+	return "", nil, false
+}
+
+// Ref returns the logical id or parameter referenced by a Ref.
+func Ref(v interface{}) (string, bool) {
+	name, arg, ok := Intrinsic(v)
+	if !ok || name != "Ref" {
+		return "", false
+	}
+	s, ok := arg.(string)
+	return s, ok
+}
+
+// GetAtt returns the logical id and attribute of an Fn::GetAtt.
+func GetAtt(v interface{}) (string, string, bool) {
+	name, arg, ok := Intrinsic(v)
+	if !ok || name != "Fn::GetAtt" {
+		return "", "", false
+	}
+	switch a := arg.(type) {
+	case string:
+		parts := strings.SplitN(a, ".", 2)
+		if len(parts) == 2 {
+			return parts[0], parts[1], true
+		}
+	case []interface{}:
+		if len(a) == 2 {
+			resource, ok1 := a[0].(string)
+			attribute, ok2 := a[1].(string)
+			return resource, attribute, ok1 && ok2
+		}
+	}
+	return "", "", false
+}
+
+// Sub returns the string and variables of an Fn::Sub.
+func Sub(v interface{}) (string, map[string]interface{}, bool) {
+	name, arg, ok := Intrinsic(v)
+	if !ok || name != "Fn::Sub" {
+		return "", nil, false
+	}
+	switch a := arg.(type) {
+	case string:
+		return a, map[string]interface{}{}, true
+	case []interface{}:
+		if len(a) == 2 {
+			s, ok1 := a[0].(string)
+			vars, ok2 := a[1].(map[string]interface{})
+			return s, vars, ok1 && ok2
+		}
+	}
+	return "", nil, false
+}
+
+// SubPart is a literal or a variable of the string of an Fn::Sub.
+type SubPart struct {
+	Literal  string
+	Variable string
+}
+
+// SubParts splits the string of an Fn::Sub into literals and variables. The
+// escaped ${!Literal} is a literal ${Literal}.
+func SubParts(s string) []SubPart {
+	parts := []SubPart{}
+	literal := ""
+	for {
+		start := strings.Index(s, "${")
+		if start < 0 {
+			break
+		}
+		end := strings.Index(s[start:], "}")
+		if end < 0 {
+			break
+		}
+		literal += s[:start]
+		variable := s[start+2 : start+end]
+		if strings.HasPrefix(variable, "!") {
+			literal += "${" + variable[1:] + "}"
+		} else {
+			if literal != "" {
+				parts = append(parts, SubPart{Literal: literal})
+				literal = ""
+			}
+			parts = append(parts, SubPart{Variable: variable})
+		}
+		s = s[start+end+1:]
+	}
+	if literal+s != "" {
+		parts = append(parts, SubPart{Literal: literal + s})
+	}
+	return parts
+}
+
+// Walk calls fn with every value of v, parents before their children, in a
+// stable order.
+func Walk(v interface{}, fn func(v interface{})) {
+	fn(v)
+	switch t := v.(type) {
+	case map[string]interface{}:
+		keys := []string{}
+		for k := range t {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			Walk(t[k], fn)
+		}
+	case []interface{}:
+		for _, e := range t {
+			Walk(e, fn)
+		}
+	}
+}
+
+// LogicalIDs returns the logical ids of the resources in a stable order.
+func (t Template) LogicalIDs() []string {
+	ids := []string{}
+	for id := range t.Resources {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	return ids
+}
@@ -0,0 +1,78 @@
+package cfn
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseShortTags(t *testing.T) {
+	template, err := Parse([]byte(`
+Resources:
+  Queue:
+    Type: AWS::SQS::Queue
+    Properties:
+      Ref: !Ref Topic
+      GetAtt: !GetAtt Topic.TopicName
+      GetAttList: !GetAtt [Topic, TopicName]
+      Sub: !Sub "${AWS::StackName}-queue"
+      SubVariables: !Sub ["${Name}-queue", {Name: !Ref Topic}]
+      Join: !Join ["-", [!Ref Topic, queue]]
+      Number: 10
+      Bool: true
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]interface{}{
+		"Ref":          map[string]interface{}{"Ref": "Topic"},
+		"GetAtt":       map[string]interface{}{"Fn::GetAtt": []interface{}{"Topic", "TopicName"}},
+		"GetAttList":   map[string]interface{}{"Fn::GetAtt": []interface{}{"Topic", "TopicName"}},
+		"Sub":          map[string]interface{}{"Fn::Sub": "${AWS::StackName}-queue"},
+		"SubVariables": map[string]interface{}{"Fn::Sub": []interface{}{"${Name}-queue", map[string]interface{}{"Name": map[string]interface{}{"Ref": "Topic"}}}},
+		"Join":         map[string]interface{}{"Fn::Join": []interface{}{"-", []interface{}{map[string]interface{}{"Ref": "Topic"}, "queue"}}},
+		"Number":       float64(10),
+		"Bool":         true,
+	}
+	if got := template.Resources["Queue"].Properties; !reflect.DeepEqual(got, want) {
+		t.Errorf("Parse() properties = %#v, want %#v", got, want)
+	}
+
+	if id, ok := Ref(want["Ref"]); !ok || id != "Topic" {
+		t.Errorf("Ref() = %q, %v", id, ok)
+	}
+	if id, attribute, ok := GetAtt(want["GetAtt"]); !ok || id != "Topic" || attribute != "TopicName" {
+		t.Errorf("GetAtt() = %q, %q, %v", id, attribute, ok)
+	}
+	if format, vars, ok := Sub(want["SubVariables"]); !ok || format != "${Name}-queue" || len(vars) != 1 {
+		t.Errorf("Sub() = %q, %v, %v", format, vars, ok)
+	}
+}
+
+func TestSubParts(t *testing.T) {
+	tests := []struct {
+		s    string
+		want []SubPart
+	}{
+		{"", []SubPart{}},
+		{"queue", []SubPart{{Literal: "queue"}}},
+		{"${Name}", []SubPart{{Variable: "Name"}}},
+		{"arn:${AWS::Partition}:sqs:${AWS::Region}:${AWS::AccountId}:${Queue.QueueName}", []SubPart{
+			{Literal: "arn:"},
+			{Variable: "AWS::Partition"},
+			{Literal: ":sqs:"},
+			{Variable: "AWS::Region"},
+			{Literal: ":"},
+			{Variable: "AWS::AccountId"},
+			{Literal: ":"},
+			{Variable: "Queue.QueueName"},
+		}},
+		{"${!Literal}-${Name}", []SubPart{{Literal: "${Literal}-"}, {Variable: "Name"}}},
+		{"${Name}-${!Literal}", []SubPart{{Variable: "Name"}, {Literal: "-${Literal}"}}},
+		{"unterminated ${Name", []SubPart{{Literal: "unterminated ${Name"}}},
+	}
+	for _, tt := range tests {
+		if got := SubParts(tt.s); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("SubParts(%q) = %#v, want %#v", tt.s, got, tt.want)
+		}
+	}
+}
@@ -3,10 +3,7 @@ package codegen
 import (
 	"bufio"
 	"bytes"
-	"fmt"
-	"io/ioutil"
-	"os"
-	"strings"
+	"sort"
 	"text/template"
 
 	"github.com/cr-norton/tfconvert/pkg/templates"
@@ -14,18 +11,25 @@ import (
 	"github.com/pkg/errors"
 )
 
-func Generate(stack Stack, options types.Options, functions map[string]interface{}) (map[string]string, error) {
+// Generate writes the stack as terraform. Resources are written with hclwrite,
+// then templates registered by out of tree handlers and templates found in
+// options.TemplateDir are rendered, replacing output files of the same name.
+func Generate(stack HCLStack, options types.Options, functions map[string]interface{}) (map[string]string, error) {
+	tfout := GenerateHCL(stack)
+
 	tmpl, err := parseTemplate(functions)
 	if err != nil {
 		return nil, errors.Wrap(err, "unable to parse templates")
 	}
 
-	srcs, err := listTemplates()
-	if err != nil {
-		return nil, err
+	srcs := templates.Registered()
+	if options.TemplateDir != "" {
+		srcs, err = parseOverrides(tmpl, srcs, options.TemplateDir)
+		if err != nil {
+			return nil, err
+		}
 	}
 
-	tfout := map[string]string{}
 	for _, src := range srcs {
 		out, err := executeTemplate(tmpl, src, stack)
 		if err != nil {
@@ -34,6 +38,14 @@ func Generate(stack Stack, options types.Options, functions map[string]interface
 		name := outName(src)
 		tfout[name] = string(out)
 	}
+
+	for name, content := range tfout {
+		formatted, err := Format(name, content)
+		if err != nil {
+			return nil, err
+		}
+		tfout[name] = formatted
+	}
 	return tfout, nil
 }
 
@@ -47,19 +59,38 @@ func parseTemplate(funcs map[string]interface{}) (*template.Template, error) {
 	return tmpl, nil
 }
 
-func listTemplates() ([]string, error) {
-	dir := fmt.Sprintf("%s/src/github.com/cr-norton/tfconvert/pkg/templates", os.Getenv("GOPATH"))
-	infos, err := ioutil.ReadDir(dir)
+// parseOverrides parses the templates in dir over the embedded ones, replacing
+// templates of the same name and adding the rest as extra output files.
+func parseOverrides(tmpl *template.Template, srcs []string, dir string) ([]string, error) {
+	overrides, err := templates.ReadDir(dir)
 	if err != nil {
-		return nil, errors.Wrap(err, "unable to list templates")
+		return nil, errors.Wrap(err, "unable to read template directory")
 	}
-	paths := []string{}
-	for _, info := range infos {
-		if strings.HasSuffix(info.Name(), ".tmpl") {
-			paths = append(paths, info.Name())
+
+	names := []string{}
+	for name := range overrides {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		if _, err := tmpl.New(name).Parse(overrides[name]); err != nil {
+			return nil, errors.Wrapf(err, "unable to parse template %s", name)
+		}
+		if !contains(srcs, name) {
+			srcs = append(srcs, name)
 		}
 	}
-	return paths, nil
+	return srcs, nil
+}
+
+func contains(strs []string, str string) bool {
+	for _, s := range strs {
+		if s == str {
+			return true
+		}
+	}
+	return false
 }
 
 func executeTemplate(t *template.Template, name string, params interface{}) ([]byte, error) {
@@ -76,7 +107,3 @@ func executeTemplate(t *template.Template, name string, params interface{}) ([]b
 
 	return buf.Bytes(), nil
 }
-
-func outName(fname string) string {
-	return strings.Replace(fname, ".tmpl", ".tf", 1)
-}
@@ -6,10 +6,15 @@ import (
 	"fmt"
 	"regexp"
 	"strings"
+
+	"github.com/hashicorp/hcl/v2/hclwrite"
 )
 
-var matchFirstCap = regexp.MustCompile("(.)([A-Z][a-z]+)")
+// words are separated by an underscore unless one already separates them, as
+// in the Api_Prod of a stage
+var matchFirstCap = regexp.MustCompile("([^_])([A-Z][a-z]+)")
 var matchAllCap = regexp.MustCompile("([a-z0-9])([A-Z])")
+var matchInvalid = regexp.MustCompile("[^a-z0-9_-]")
 
 func mergeTemplateFunctions(pfunctions map[string]interface{}) map[string]interface{} {
 	functions := map[string]interface{}{
@@ -25,7 +30,7 @@ func mergeTemplateFunctions(pfunctions map[string]interface{}) map[string]interf
 
 func lookup(stack Stack, id string) string {
 	if res := stack.Lookup(id); res != nil {
-		return fmt.Sprintf("%s.%s.%s", res.Type, tfName(res.Identifier), res.OutputKey)
+		return string(hclwrite.TokensForTraversal(ResourceTraversal(*res)).Bytes())
 	}
 	return fmt.Sprintf(`"%s"`, id)
 }
@@ -38,7 +43,7 @@ func formatJSON(str string) string {
 }
 
 func tfName(name string) string {
-	return toSnakeCase(name)
+	return matchInvalid.ReplaceAllString(toSnakeCase(name), "_")
 }
 
 func toSnakeCase(str string) string {
@@ -0,0 +1,344 @@
+package codegen
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/cr-norton/tfconvert/pkg/types"
+	"github.com/hashicorp/hcl/v2"
+	"github.com/hashicorp/hcl/v2/hclsyntax"
+	"github.com/hashicorp/hcl/v2/hclwrite"
+	"github.com/pkg/errors"
+	"github.com/zclconf/go-cty/cty"
+	ctyjson "github.com/zclconf/go-cty/cty/json"
+)
+
+// HCLResource is implemented by resources that write their own terraform.
+type HCLResource interface {
+	WriteHCL(body *hclwrite.Body, stack Stack)
+}
+
+// HCLStack is a stack whose resources are written with hclwrite, grouped by
+// the name of the template they belong to.
+type HCLStack interface {
+	Stack
+	HCLResources() map[string][]HCLResource
+}
+
+// GenerateHCL writes every resource of the stack to the output file of its
+// template.
+func GenerateHCL(stack HCLStack) map[string]string {
+	tfout := map[string]string{}
+	for tmpl, resources := range stack.HCLResources() {
+		f := hclwrite.NewFile()
+		for i, r := range resources {
+			if i > 0 {
+				f.Body().AppendNewline()
+			}
+			r.WriteHCL(f.Body(), stack)
+		}
+		tfout[outName(tmpl)] = string(f.Bytes())
+	}
+	return tfout
+}
+
+// Format checks that content is valid hcl and formats it canonically. Parse
+// errors name the offending file and line.
+func Format(name string, content string) (string, error) {
+	if _, diags := hclsyntax.ParseConfig([]byte(content), name, hcl.Pos{Line: 1, Column: 1}); diags.HasErrors() {
+		return "", errors.Wrap(diags, "generated invalid terraform")
+	}
+	return string(hclwrite.Format([]byte(content))), nil
+}
+
+// ResourceBlock appends the resource block of a resource and returns its body.
+func ResourceBlock(body *hclwrite.Body, resource types.Resource) *hclwrite.Body {
+	return body.AppendNewBlock("resource", []string{resource.Type, tfName(resource.Identifier)}).Body()
+}
+
+// CheckAddresses returns an error naming every resource that has no resource
+// block in the generated files, since importing it would fail, and every
+// address declared by more than one block.
+func CheckAddresses(tfout map[string]string, resources []types.Resource) error {
+	names := []string{}
+	for name := range tfout {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	declared := map[string]int{}
+	duplicates := []string{}
+	for _, name := range names {
+		f, diags := hclsyntax.ParseConfig([]byte(tfout[name]), name, hcl.Pos{Line: 1, Column: 1})
+		if diags.HasErrors() {
+			return errors.Wrap(diags, "generated invalid terraform")
+		}
+		for _, block := range f.Body.(*hclsyntax.Body).Blocks {
+			if block.Type == "resource" && len(block.Labels) == 2 {
+				address := block.Labels[0] + "." + block.Labels[1]
+				declared[address]++
+				if declared[address] == 2 {
+					duplicates = append(duplicates, address)
+				}
+			}
+		}
+	}
+	if len(duplicates) > 0 {
+		return errors.Errorf("resources declared more than once in generated terraform: %s", strings.Join(duplicates, ", "))
+	}
+
+	missing := []string{}
+	for _, resource := range resources {
+		address := fmt.Sprintf("%s.%s", resource.Type, tfName(resource.Identifier))
+		if declared[address] == 0 {
+			missing = append(missing, address)
+		}
+	}
+	if len(missing) > 0 {
+		return errors.Errorf("imported resources missing from generated terraform: %s", strings.Join(missing, ", "))
+	}
+	return nil
+}
+
+// SetReference sets an attribute to a reference to the resource indexed by id,
+// or to id itself when it isn't part of the stack.
+func SetReference(body *hclwrite.Body, name string, stack Stack, id string) {
+	body.SetAttributeRaw(name, Reference(stack, id))
+}
+
+// Reference returns the tokens for a reference to the resource indexed by id,
+// or a quoted id when it isn't part of the stack.
+func Reference(stack Stack, id string) hclwrite.Tokens {
+	if res := stack.Lookup(id); res != nil {
+		return hclwrite.TokensForTraversal(ResourceTraversal(*res))
+	}
+	if i, ok := stack.(Interpolator); ok {
+		if parts := i.Interpolation(id); parts != nil {
+			return Interpolate(parts)
+		}
+	}
+	return hclwrite.TokensForValue(cty.StringVal(id))
+}
+
+// SetInterpolation sets an attribute to a string, written as a string template
+// when it was built from references. Unlike SetReference, the string itself is
+// never looked up, so a resource can set its own name.
+func SetInterpolation(body *hclwrite.Body, name string, stack Stack, s *string) {
+	if s == nil {
+		return
+	}
+	if i, ok := stack.(Interpolator); ok {
+		if parts := i.Interpolation(*s); parts != nil {
+			body.SetAttributeRaw(name, Interpolate(parts))
+			return
+		}
+	}
+	body.SetAttributeValue(name, cty.StringVal(*s))
+}
+
+// InterpolationPart is a literal or a reference of an interpolated string.
+type InterpolationPart struct {
+	Literal  string
+	Resource *types.Resource
+}
+
+// Interpolator is implemented by stacks that know how strings were built from
+// references, such as the result of an Fn::Sub.
+type Interpolator interface {
+	Interpolation(value string) []InterpolationPart
+}
+
+// Interpolate returns the tokens for a string template of the parts, such as
+// "arn:aws:s3:::${aws_s3_bucket.name.id}/*".
+func Interpolate(parts []InterpolationPart) hclwrite.Tokens {
+	tokens := hclwrite.Tokens{{Type: hclsyntax.TokenOQuote, Bytes: []byte(`"`)}}
+	for _, part := range parts {
+		if part.Resource == nil {
+			// the quoted literal of the escaped string, without its quotes
+			lit := hclwrite.TokensForValue(cty.StringVal(part.Literal))
+			tokens = append(tokens, lit[1:len(lit)-1]...)
+			continue
+		}
+		tokens = append(tokens, &hclwrite.Token{Type: hclsyntax.TokenTemplateInterp, Bytes: []byte("${")})
+		tokens = append(tokens, hclwrite.TokensForTraversal(ResourceTraversal(*part.Resource))...)
+		tokens = append(tokens, &hclwrite.Token{Type: hclsyntax.TokenTemplateSeqEnd, Bytes: []byte("}")})
+	}
+	return append(tokens, &hclwrite.Token{Type: hclsyntax.TokenCQuote, Bytes: []byte(`"`)})
+}
+
+// ResourceTraversal returns the traversal of the output of a resource, such as
+// aws_iam_role.name.arn. Resources without an output key are values of their
+// own, such as a variable. The type and output key may be nested, as in
+// data.terraform_remote_state.name.outputs.arn.
+func ResourceTraversal(res types.Resource) hcl.Traversal {
+	parts := strings.Split(res.Type, ".")
+	attrs := append(parts[1:], tfName(res.Identifier))
+	if res.OutputKey != "" {
+		attrs = append(attrs, strings.Split(res.OutputKey, ".")...)
+	}
+	return Traversal(parts[0], attrs...)
+}
+
+// Address returns the address of a resource, prefixed with its module.
+func Address(res types.Resource) hcl.Traversal {
+	if res.Module == "" {
+		return Traversal(res.Type, tfName(res.Identifier))
+	}
+	return Traversal("module", tfName(res.Module), res.Type, tfName(res.Identifier))
+}
+
+// Traversal returns an absolute traversal such as aws_iam_role.name.arn.
+func Traversal(root string, attrs ...string) hcl.Traversal {
+	traversal := hcl.Traversal{hcl.TraverseRoot{Name: root}}
+	for _, attr := range attrs {
+		traversal = append(traversal, hcl.TraverseAttr{Name: attr})
+	}
+	return traversal
+}
+
+// SetTags sets the tags attribute to the stack tags.
+func SetTags(body *hclwrite.Body, stack Stack) {
+	body.SetAttributeValue("tags", StringMap(stack.Tags()))
+}
+
+// StringMap converts a map of strings to a cty value.
+func StringMap(m map[string]string) cty.Value {
+	if len(m) == 0 {
+		return cty.MapValEmpty(cty.String)
+	}
+	vals := map[string]cty.Value{}
+	for k, v := range m {
+		vals[k] = cty.StringVal(v)
+	}
+	return cty.MapVal(vals)
+}
+
+// StringList converts a slice of strings to a cty value.
+func StringList(strs []string) cty.Value {
+	if len(strs) == 0 {
+		return cty.ListValEmpty(cty.String)
+	}
+	vals := []cty.Value{}
+	for _, s := range strs {
+		vals = append(vals, cty.StringVal(s))
+	}
+	return cty.ListVal(vals)
+}
+
+// JSONEncode returns the tokens for a jsonencode call of a json document, so
+// the document is written as hcl. Documents that don't parse are written as a
+// quoted string.
+func JSONEncode(document string) hclwrite.Tokens {
+	bytes := []byte(document)
+	ty, err := ctyjson.ImpliedType(bytes)
+	if err != nil {
+		return hclwrite.TokensForValue(cty.StringVal(document))
+	}
+	val, err := ctyjson.Unmarshal(bytes, ty)
+	if err != nil {
+		return hclwrite.TokensForValue(cty.StringVal(document))
+	}
+	return FunctionCall("jsonencode", hclwrite.TokensForValue(val))
+}
+
+// JSONEncodeReferences is JSONEncode with every string of the document
+// referencing the resource it identifies, such as the arns of a policy.
+func JSONEncodeReferences(stack Stack, document string) hclwrite.Tokens {
+	var v interface{}
+	if err := json.Unmarshal([]byte(document), &v); err != nil {
+		return hclwrite.TokensForValue(cty.StringVal(document))
+	}
+	return FunctionCall("jsonencode", jsonTokens(stack, v))
+}
+
+func jsonTokens(stack Stack, v interface{}) hclwrite.Tokens {
+	switch t := v.(type) {
+	case map[string]interface{}:
+		keys := []string{}
+		for k := range t {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		attrs := []ObjectAttribute{}
+		for _, k := range keys {
+			attrs = append(attrs, ObjectAttribute{Name: k, Value: jsonTokens(stack, t[k])})
+		}
+		return Object(attrs...)
+	case []interface{}:
+		elems := []hclwrite.Tokens{}
+		for _, e := range t {
+			elems = append(elems, jsonTokens(stack, e))
+		}
+		return List(elems...)
+	case string:
+		return Reference(stack, t)
+	case float64:
+		return hclwrite.TokensForValue(cty.NumberFloatVal(t))
+	case bool:
+		return hclwrite.TokensForValue(cty.BoolVal(t))
+	}
+	return hclwrite.TokensForValue(cty.NullVal(cty.DynamicPseudoType))
+}
+
+// FunctionCall returns the tokens for a terraform function call.
+func FunctionCall(name string, args ...hclwrite.Tokens) hclwrite.Tokens {
+	tokens := hclwrite.Tokens{
+		{Type: hclsyntax.TokenIdent, Bytes: []byte(name)},
+		{Type: hclsyntax.TokenOParen, Bytes: []byte("(")},
+	}
+	for i, arg := range args {
+		if i > 0 {
+			tokens = append(tokens, &hclwrite.Token{Type: hclsyntax.TokenComma, Bytes: []byte(",")})
+		}
+		tokens = append(tokens, arg...)
+	}
+	return append(tokens, &hclwrite.Token{Type: hclsyntax.TokenCParen, Bytes: []byte(")")})
+}
+
+// List returns the tokens for a list literal.
+func List(elems ...hclwrite.Tokens) hclwrite.Tokens {
+	tokens := hclwrite.Tokens{{Type: hclsyntax.TokenOBrack, Bytes: []byte("[")}}
+	for i, e := range elems {
+		if i > 0 {
+			tokens = append(tokens, &hclwrite.Token{Type: hclsyntax.TokenComma, Bytes: []byte(",")})
+		}
+		tokens = append(tokens, e...)
+	}
+	return append(tokens, &hclwrite.Token{Type: hclsyntax.TokenCBrack, Bytes: []byte("]")})
+}
+
+// ObjectAttribute is a single attribute of an object literal.
+type ObjectAttribute struct {
+	Name  string
+	Value hclwrite.Tokens
+}
+
+// Object returns the tokens for an object literal, keeping attribute order.
+func Object(attrs ...ObjectAttribute) hclwrite.Tokens {
+	tokens := hclwrite.Tokens{
+		{Type: hclsyntax.TokenOBrace, Bytes: []byte("{")},
+		{Type: hclsyntax.TokenNewline, Bytes: []byte("\n")},
+	}
+	for _, attr := range attrs {
+		name := hclwrite.TokensForValue(cty.StringVal(attr.Name))
+		if hclsyntax.ValidIdentifier(attr.Name) {
+			name = hclwrite.Tokens{{Type: hclsyntax.TokenIdent, Bytes: []byte(attr.Name)}}
+		}
+		tokens = append(tokens, name...)
+		tokens = append(tokens, &hclwrite.Token{Type: hclsyntax.TokenEqual, Bytes: []byte("=")})
+		tokens = append(tokens, attr.Value...)
+		tokens = append(tokens, &hclwrite.Token{Type: hclsyntax.TokenNewline, Bytes: []byte("\n")})
+	}
+	return append(tokens, &hclwrite.Token{Type: hclsyntax.TokenCBrace, Bytes: []byte("}")})
+}
+
+// Name returns the terraform name of a CloudFormation logical id.
+func Name(logicalID string) string {
+	return tfName(logicalID)
+}
+
+func outName(fname string) string {
+	return strings.Replace(fname, ".tmpl", ".tf", 1)
+}
@@ -4,4 +4,5 @@ import "github.com/cr-norton/tfconvert/pkg/types"
 
 type Stack interface {
 	Lookup(id string) *types.Resource
+	Tags() map[string]string
 }
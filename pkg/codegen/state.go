@@ -0,0 +1,189 @@
+package codegen
+
+import (
+	"crypto/rand"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+
+	"github.com/cr-norton/tfconvert/pkg/types"
+	"github.com/pkg/errors"
+)
+
+const stateProvider = `provider["registry.terraform.io/hashicorp/aws"]`
+
+// StateResource is implemented by resources that can be written straight to
+// terraform state instead of being imported.
+type StateResource interface {
+	Resource() types.Resource
+	// SchemaVersion is the provider schema version of the attributes.
+	SchemaVersion() int
+	// StateAttributes are the attributes of the resource as the provider stores
+	// them. The provider refreshes everything else on the first plan.
+	StateAttributes() map[string]interface{}
+}
+
+// State is a terraform v4 state file.
+type State struct {
+	Version          int                    `json:"version"`
+	TerraformVersion string                 `json:"terraform_version"`
+	Serial           int                    `json:"serial"`
+	Lineage          string                 `json:"lineage"`
+	Outputs          map[string]interface{} `json:"outputs"`
+	Resources        []StateEntry           `json:"resources"`
+}
+
+// StateEntry is a single managed resource in a state file.
+type StateEntry struct {
+	Module    string          `json:"module,omitempty"`
+	Mode      string          `json:"mode"`
+	Type      string          `json:"type"`
+	Name      string          `json:"name"`
+	Provider  string          `json:"provider"`
+	Instances []StateInstance `json:"instances"`
+}
+
+// StateInstance is the only instance of a resource without count or for_each.
+type StateInstance struct {
+	SchemaVersion       int                    `json:"schema_version"`
+	Attributes          map[string]interface{} `json:"attributes"`
+	SensitiveAttributes []interface{}          `json:"sensitive_attributes"`
+}
+
+// Address returns the resource address, e.g. aws_sqs_queue.name.
+func (e StateEntry) Address() string {
+	if e.Module != "" {
+		return fmt.Sprintf("%s.%s.%s", e.Module, e.Type, e.Name)
+	}
+	return fmt.Sprintf("%s.%s", e.Type, e.Name)
+}
+
+// GenerateState returns a terraform v4 state file holding the resources.
+func GenerateState(resources []StateResource) ([]byte, error) {
+	return GenerateModuleState(map[string][]StateResource{"": resources})
+}
+
+// GenerateModuleState returns a terraform v4 state file holding the resources
+// of every module, keyed by module name. The root module has an empty name.
+func GenerateModuleState(modules map[string][]StateResource) ([]byte, error) {
+	lineage, err := newLineage()
+	if err != nil {
+		return nil, err
+	}
+
+	state := State{
+		Version: 4,
+		// oldest release reading v4 state, newer terraform versions upgrade it
+		TerraformVersion: "1.0.0",
+		Serial:           1,
+		Lineage:          lineage,
+		Outputs:          map[string]interface{}{},
+		Resources:        []StateEntry{},
+	}
+	for module, resources := range modules {
+		if module != "" {
+			module = "module." + tfName(module)
+		}
+		for _, r := range resources {
+			res := r.Resource()
+			state.Resources = append(state.Resources, StateEntry{
+				Module:   module,
+				Mode:     "managed",
+				Type:     res.Type,
+				Name:     tfName(res.Identifier),
+				Provider: stateProvider,
+				Instances: []StateInstance{{
+					SchemaVersion:       r.SchemaVersion(),
+					Attributes:          r.StateAttributes(),
+					SensitiveAttributes: []interface{}{},
+				}},
+			})
+		}
+	}
+	sort.Slice(state.Resources, func(i, j int) bool {
+		return state.Resources[i].Address() < state.Resources[j].Address()
+	})
+	return json.MarshalIndent(state, "", "  ")
+}
+
+// Unstated returns the resources missing from the state of the modules, which
+// still have to be imported. Modules are keyed by name like the Module of the
+// resources, the root module by an empty name.
+func Unstated(resources []types.Resource, modules map[string][]StateResource) []types.Resource {
+	stated := map[string]bool{}
+	for module, rs := range modules {
+		for _, r := range rs {
+			res := r.Resource()
+			res.Module = module
+			stated[stateKey(res)] = true
+		}
+	}
+
+	unstated := []types.Resource{}
+	for _, res := range resources {
+		if !stated[stateKey(res)] {
+			unstated = append(unstated, res)
+		}
+	}
+	return unstated
+}
+
+func stateKey(res types.Resource) string {
+	return fmt.Sprintf("%s/%s.%s", tfName(res.Module), res.Type, tfName(res.Identifier))
+}
+
+// CompareState compares a generated state file with one produced by
+// terraform import and describes every difference. Only resources present in
+// the imported state and attributes present in the generated state are
+// compared, so a sample of the stack can be imported to verify the rest.
+func CompareState(generated []byte, imported []byte) ([]string, error) {
+	var gen, imp State
+	if err := json.Unmarshal(generated, &gen); err != nil {
+		return nil, errors.Wrap(err, "unable to parse generated state")
+	}
+	if err := json.Unmarshal(imported, &imp); err != nil {
+		return nil, errors.Wrap(err, "unable to parse imported state")
+	}
+
+	genByAddress := map[string]StateEntry{}
+	for _, e := range gen.Resources {
+		genByAddress[e.Address()] = e
+	}
+
+	diffs := []string{}
+	for _, e := range imp.Resources {
+		if e.Mode != "managed" || len(e.Instances) == 0 {
+			continue
+		}
+		g, has := genByAddress[e.Address()]
+		if !has {
+			diffs = append(diffs, fmt.Sprintf("%s: missing from generated state", e.Address()))
+			continue
+		}
+		if g.Instances[0].SchemaVersion != e.Instances[0].SchemaVersion {
+			diffs = append(diffs, fmt.Sprintf("%s: schema version %d, imported %d", e.Address(), g.Instances[0].SchemaVersion, e.Instances[0].SchemaVersion))
+		}
+
+		names := []string{}
+		for name := range g.Instances[0].Attributes {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			gv, iv := g.Instances[0].Attributes[name], e.Instances[0].Attributes[name]
+			if !reflect.DeepEqual(gv, iv) {
+				diffs = append(diffs, fmt.Sprintf("%s.%s: generated %v, imported %v", e.Address(), name, gv, iv))
+			}
+		}
+	}
+	return diffs, nil
+}
+
+func newLineage() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", errors.Wrap(err, "unable to generate state lineage")
+	}
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:]), nil
+}
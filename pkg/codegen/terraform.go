@@ -2,16 +2,46 @@ package codegen
 
 import (
 	"fmt"
+	"regexp"
+	"strings"
 
 	"github.com/cr-norton/tfconvert/pkg/types"
+	"github.com/hashicorp/hcl/v2/hclwrite"
+	"github.com/zclconf/go-cty/cty"
 )
 
+// matchUnsafe matches import ids the shell would expand or split, such as the
+// $default stage of an http api
+var matchUnsafe = regexp.MustCompile(`[^A-Za-z0-9_@%+=:,./-]`)
+
 func GenerateImportScript(resources []types.Resource) ([]string, error) {
 	commands := []string{}
 	for _, resource := range resources {
-		name := tfName(resource.Identifier)
-		command := fmt.Sprintf("terraform import %s.%s %s", resource.Type, name, resource.ImportKey)
+		address := hclwrite.TokensForTraversal(Address(resource)).Bytes()
+		command := fmt.Sprintf("terraform import %s %s", address, shellQuote(resource.ImportKey))
 		commands = append(commands, command)
 	}
 	return commands, nil
 }
+
+func shellQuote(s string) string {
+	if !matchUnsafe.MatchString(s) {
+		return s
+	}
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
+
+// GenerateImportBlocks returns terraform 1.5+ import blocks for the resources,
+// so the migration can be reviewed in a single plan.
+func GenerateImportBlocks(resources []types.Resource) (string, error) {
+	f := hclwrite.NewFile()
+	for i, resource := range resources {
+		if i > 0 {
+			f.Body().AppendNewline()
+		}
+		b := f.Body().AppendNewBlock("import", nil).Body()
+		b.SetAttributeTraversal("to", Address(resource))
+		b.SetAttributeValue("id", cty.StringVal(resource.ImportKey))
+	}
+	return Format("imports.tf", string(f.Bytes()))
+}
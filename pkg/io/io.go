@@ -2,14 +2,12 @@ package io
 
 import (
 	"encoding/json"
-	"fmt"
 	"io/ioutil"
 	"os"
 )
 
 func ReadFile(filename string, output interface{}) error {
-	path := fmt.Sprintf("%s/src/github.com/cr-norton/tfconvert/%s", os.Getenv("GOPATH"), filename)
-	bytes, err := ioutil.ReadFile(path)
+	bytes, err := ioutil.ReadFile(filename)
 	if err != nil {
 		return err
 	}
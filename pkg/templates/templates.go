@@ -0,0 +1,95 @@
+// Package templates embeds the terraform templates rendered by codegen.
+package templates
+
+import (
+	"embed"
+	"io/fs"
+	"io/ioutil"
+	"path/filepath"
+	"sort"
+	"text/template"
+)
+
+//go:embed *.tmpl
+var files embed.FS
+
+var templates = map[string]string{}
+
+var registered = []string{}
+
+func init() {
+	names, err := fs.Glob(files, "*.tmpl")
+	if err != nil {
+		panic(err)
+	}
+	for _, name := range names {
+		bytes, err := files.ReadFile(name)
+		if err != nil {
+			panic(err)
+		}
+		templates[name] = string(bytes)
+	}
+}
+
+// Register adds a template to the set parsed by Parse, for resource handlers
+// that live outside this package.
+func Register(name string, text string) {
+	if _, has := templates[name]; !has {
+		registered = append(registered, name)
+	}
+	templates[name] = text
+}
+
+// Registered returns the names of the templates added with Register.
+func Registered() []string {
+	return append([]string{}, registered...)
+}
+
+// Names returns the names of every declared template, sorted.
+func Names() []string {
+	names := []string{}
+	for name := range templates {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// ReadDir reads the .tmpl files in a directory, keyed by file name.
+func ReadDir(dir string) (map[string]string, error) {
+	infos, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	overrides := map[string]string{}
+	for _, info := range infos {
+		if info.IsDir() || filepath.Ext(info.Name()) != ".tmpl" {
+			continue
+		}
+		bytes, err := ioutil.ReadFile(filepath.Join(dir, info.Name()))
+		if err != nil {
+			return nil, err
+		}
+		overrides[info.Name()] = string(bytes)
+	}
+	return overrides, nil
+}
+
+// Parse parses declared templates.
+func Parse(t *template.Template) (*template.Template, error) {
+	for name, s := range templates {
+		var tmpl *template.Template
+		if t == nil {
+			t = template.New(name)
+		}
+		if name == t.Name() {
+			tmpl = t
+		} else {
+			tmpl = t.New(name)
+		}
+		if _, err := tmpl.Parse(s); err != nil {
+			return nil, err
+		}
+	}
+	return t, nil
+}
@@ -1,8 +1,59 @@
 package types
 
+const (
+	// DefaultMaxRetries is the number of retries of a throttled or failed aws call
+	DefaultMaxRetries = 10
+	// DefaultRateLimit is the maximum requests per second made to each aws service
+	DefaultRateLimit = 20
+)
+
+const (
+	// NestedStacksFlatten converts nested stacks into their parent, prefixing
+	// their logical ids with the logical id of the nested stack and an underscore
+	NestedStacksFlatten = "flatten"
+	// NestedStacksModules converts nested stacks into modules of their own
+	NestedStacksModules = "modules"
+)
+
+const (
+	// ExportReferencesData references imported exports with aws_cloudformation_export data sources
+	ExportReferencesData = "data"
+	// ExportReferencesRemoteState references imported exports with the
+	// terraform_remote_state of the exporting stack
+	ExportReferencesRemoteState = "remote_state"
+	// ExportReferencesNone writes imported exports as literals
+	ExportReferencesNone = "none"
+)
+
 type Options struct {
-	StackName      string            `json:"stack_name"`
-	ServiceName    string            `json:"service_name"`
-	Region         string            `json:"region"`
-	AdditionalTags map[string]string `json:"additional_tags"`
+	StackName       string            `json:"stack_name"`
+	StackNames      []string          `json:"stack_names"`
+	ServiceName     string            `json:"service_name"`
+	Region          string            `json:"region"`
+	AdditionalTags  map[string]string `json:"additional_tags"`
+	TemplateDir     string            `json:"template_dir"`
+	Concurrency     int               `json:"concurrency"`
+	MaxRetries      int               `json:"max_retries"`
+	RateLimit       float64           `json:"rate_limit"`
+	ContinueOnError bool              `json:"continue_on_error"`
+	NestedStacks    string            `json:"nested_stacks"`
+	// ExportReferences is how values imported from other stacks are referenced
+	ExportReferences   string            `json:"export_references"`
+	RemoteStateBackend string            `json:"remote_state_backend"`
+	RemoteStateConfig  map[string]string `json:"remote_state_config"`
+	// TemplateFile is a template converted instead of a deployed stack
+	TemplateFile string `json:"template_file"`
+	// GroupFunctions writes every function to a file of its own along with
+	// its role, event sources and log group
+	GroupFunctions bool `json:"group_functions"`
+}
+
+// Stacks returns the names of every stack to convert. Names holding glob
+// characters are patterns matched against the stacks of the account.
+func (o Options) Stacks() []string {
+	stacks := []string{}
+	if o.StackName != "" {
+		stacks = append(stacks, o.StackName)
+	}
+	return append(stacks, o.StackNames...)
 }
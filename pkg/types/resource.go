@@ -5,4 +5,6 @@ type Resource struct {
 	Identifier string `json:"identifier"`
 	ImportKey  string `json:"import_key"`
 	OutputKey  string `json:"output_key"`
+	// Module is the module declaring the resource, empty for the root module
+	Module string `json:"module,omitempty"`
 }